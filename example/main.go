@@ -129,7 +129,10 @@ func main() {
 	}
 	fmt.Println("pao dequeued: ", paoWasDequeued)
 
-	if err := q.Clear(ctx, "LITD_QUEUE"); err != nil {
+	if err := q.Clear(ctx, &queue.ClearReq{
+		ID:     "LITD_QUEUE",
+		Reason: "example finished",
+	}); err != nil {
 		log.Fatalf("failed to clear queue: %v", err)
 	}
 }
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dequeueAgedScript pops up to ARGV[5] members from the queue, in priority
+// order, skipping members whose enqueue time in KEYS[7] is after ARGV[6], and
+// records them as dequeued. Members without an enqueue time are eligible. It
+// returns the popped members with their scores.
+var dequeueAgedScript = redis.NewScript(dequeueLua + `
+local cutoff = tonumber(ARGV[6])
+local popped = take(tonumber(ARGV[5]), '-inf', function(member)
+	local enqueuedAt = redis.call('HGET', KEYS[7], member)
+	return enqueuedAt and tonumber(enqueuedAt) > cutoff
+end)
+record(popped)
+return popped
+`)
+
+// DequeueAgedAtLeast removes up to n items from the queue, in priority order,
+// skipping items that were enqueued less than minAge ago so that late updates
+// can settle.
+//
+// The age is computed from the time the item was first added to the queue;
+// re-enqueueing or rescoring a queued item does not reset it, while an item
+// put back after a dequeue counts as enqueued anew. Items without a recorded
+// time, such as those queued before enqueue times were recorded, are always
+// eligible. The age check, the removal and the dequeue tracking happen
+// atomically in a single Lua script.
+//
+// Returns:
+//   - A slice of strings containing the dequeued item IDs.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DequeueAgedAtLeast(ctx context.Context, queueID string, minAge time.Duration, n int) ([]string, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	vals, err := dequeueAgedScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(queueID),
+		q.dequeueArgs(true, n, time.Now().Add(-minAge).UnixMilli())...,
+	).
+		Slice()
+	if err != nil {
+		return []string{}, q.queueErr(ctx, queueID, err)
+	}
+
+	popped, err := parseScored(vals)
+	if err != nil {
+		return []string{}, err
+	}
+	return memberIDs(popped), nil
+}
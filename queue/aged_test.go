@@ -0,0 +1,64 @@
+package queue_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDequeueAgedAtLeast(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "old", Score: 2}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "new", Score: 1}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	// Re-enqueueing keeps the original enqueue time.
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "old", Score: 3}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	got, err := q.DequeueAgedAtLeast(ctx, "jobs", 100*time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("DequeueAgedAtLeast: %v", err)
+	}
+	if want := []string{"old"}; !slices.Equal(got, want) {
+		t.Fatalf("DequeueAgedAtLeast = %v; want %v", got, want)
+	}
+}
+
+func TestEnqueueTimeCleanedOnRemoval(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if err := q.Delete(ctx, &queue.DeleteReq{ID: "jobs", MemberID: "b"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if n, err := h.Client.HLen(ctx, "enqueued_at:jobs").Result(); err != nil || n != 3 {
+		t.Fatalf("HLen = %d, %v; want 3", n, err)
+	}
+
+	if err := q.Clear(ctx, &queue.ClearReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if n, err := h.Client.HLen(ctx, "enqueued_at:jobs").Result(); err != nil || n != 0 {
+		t.Fatalf("HLen after Clear = %d, %v; want 0", n, err)
+	}
+}
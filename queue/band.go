@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dequeueTopBandScript pops every member of the queue whose score is at most
+// the head score plus ARGV[5] and records them as dequeued. It returns the
+// popped members with their scores.
+var dequeueTopBandScript = redis.NewScript(dequeueLua + scoreLua + `
+local head = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if #head == 0 then
+	return head
+end
+local max = toscore(head[2]) + tonumber(ARGV[5])
+local popped = take(redis.call('ZCOUNT', KEYS[1], '-inf', max), '-inf')
+record(popped)
+return popped
+`)
+
+// DequeueTopBand removes the top priority band of the queue: every item whose
+// score is within tolerance of the head score, i.e. in [head, head+tolerance].
+// A zero tolerance removes the items tied with the head. This lets consumers
+// process one priority tier at a time.
+//
+// The band is computed, removed and recorded as dequeued atomically in a
+// single Lua script. There is no bound on the number of removed items.
+//
+// Returns:
+//   - A slice of strings containing the dequeued item IDs in priority order.
+//   - ErrInvalidRequest if tolerance is negative or not finite, or if the
+//     Service is created with WithDequeueCooldown.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DequeueTopBand(ctx context.Context, queueID string, tolerance float64) ([]string, error) {
+	if !(tolerance >= 0) || math.IsInf(tolerance, 0) {
+		return []string{}, fmt.Errorf("%w: tolerance must be non-negative and finite, got %v", ErrInvalidRequest, tolerance)
+	}
+	if err := q.rejectCooldown("DequeueTopBand"); err != nil {
+		return []string{}, err
+	}
+
+	vals, err := dequeueTopBandScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(queueID),
+		q.dequeueArgs(true, tolerance)...,
+	).
+		Slice()
+	if err != nil {
+		return []string{}, q.queueErr(ctx, queueID, err)
+	}
+
+	popped, err := parseScored(vals)
+	if err != nil {
+		return []string{}, err
+	}
+	return memberIDs(popped), nil
+}
@@ -0,0 +1,41 @@
+package queue_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDequeueTopBandTierByTier(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	scores := map[string]float64{"a": 1, "b": 1.5, "c": 2, "d": 10, "e": 10, "f": 20}
+	for id, score := range scores {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for _, want := range [][]string{{"a", "b", "c"}, {"d", "e"}, {"f"}, {}} {
+		band, err := q.DequeueTopBand(ctx, "jobs", 1)
+		if err != nil {
+			t.Fatalf("DequeueTopBand: %v", err)
+		}
+		if !slices.Equal(band, want) {
+			t.Fatalf("DequeueTopBand = %v; want %v", band, want)
+		}
+	}
+
+	for id := range scores {
+		if dequeued, err := q.IsDequeued(ctx, "jobs", id); err != nil || !dequeued {
+			t.Errorf("IsDequeued(%s) = %v, %v; want true", id, dequeued, err)
+		}
+	}
+	if total, err := q.LifetimeDequeued(ctx, "jobs"); err != nil || total != int64(len(scores)) {
+		t.Errorf("LifetimeDequeued = %d, %v; want %d", total, err, len(scores))
+	}
+}
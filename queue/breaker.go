@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// circuitBreaker is a redis.Hook short-circuiting commands with
+// ErrCircuitOpen once threshold consecutive commands failed, for cooldown.
+// After the cooldown, a single trial command is let through: the circuit
+// closes if it succeeds and opens again if it fails.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// breakerClients holds the Redis clients a circuitBreaker was installed on.
+// Hooks cannot be removed from a client, so a second breaker would stack on
+// the first one and the entries are never dropped.
+var breakerClients sync.Map
+
+// install adds b as a hook to every client, refusing clients that already
+// carry a circuit breaker.
+func (b *circuitBreaker) install(clients ...redis.UniversalClient) error {
+	var installed []redis.UniversalClient
+	for _, client := range clients {
+		if _, loaded := breakerClients.LoadOrStore(client, b); loaded {
+			for _, c := range installed {
+				breakerClients.Delete(c)
+			}
+			return fmt.Errorf("%w: the Redis client already has a circuit breaker; use a dedicated client per Service created with WithCircuitBreaker", ErrInvalidRequest)
+		}
+		installed = append(installed, client)
+	}
+	for _, client := range clients {
+		client.AddHook(b)
+	}
+	return nil
+}
+
+// allow reports whether a command may be sent to Redis.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen
+	}
+	b.trial = true
+	return nil
+}
+
+// record updates the breaker with the outcome of a command.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !isConnectionFailure(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// isConnectionFailure reports whether err means Redis could not be reached,
+// as opposed to a reply of Redis such as redis.Nil or a WRONGTYPE error, or a
+// cancellation by the caller.
+func isConnectionFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var replyErr redis.Error
+	return !errors.As(err, &replyErr)
+}
+
+func (b *circuitBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (b *circuitBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := b.allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *circuitBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := b.allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
@@ -0,0 +1,38 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t, queue.WithCircuitBreaker(2, time.Minute))
+
+	h.Server.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := h.Service.Contains(ctx, "jobs", "a"); err == nil || errors.Is(err, queue.ErrCircuitOpen) {
+			t.Fatalf("Contains #%d = %v; want a connection error", i, err)
+		}
+	}
+	if _, err := h.Service.Contains(ctx, "jobs", "a"); !errors.Is(err, queue.ErrCircuitOpen) {
+		t.Fatalf("Contains = %v; want ErrCircuitOpen", err)
+	}
+}
+
+func TestCircuitBreakerRefusesSharedClient(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t, queue.WithCircuitBreaker(2, time.Minute))
+
+	if _, err := queue.NewService(ctx, h.Client, queue.WithCircuitBreaker(2, time.Minute)); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Fatalf("NewService with a second breaker = %v; want ErrInvalidRequest", err)
+	}
+	if _, err := queue.NewService(ctx, h.Client); err != nil {
+		t.Fatalf("NewService without a breaker: %v", err)
+	}
+}
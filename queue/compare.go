@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dequeueBetterScript removes whichever of the members ARGV[5] and ARGV[6] of
+// the queue comes first in dequeue order, i.e. has the lower score or, on
+// ties, the lexically smaller ID, and records it as dequeued. It returns the
+// removed member and its score, or nil if either member is not in the queue.
+var dequeueBetterScript = redis.NewScript(dequeueLua + scoreLua + `
+local a = redis.call('ZSCORE', KEYS[1], ARGV[5])
+local b = redis.call('ZSCORE', KEYS[1], ARGV[6])
+if not a or not b then
+	return false
+end
+local winner, score = ARGV[5], a
+local na, nb = toscore(a), toscore(b)
+if nb < na or (nb == na and ARGV[6] < ARGV[5]) then
+	winner, score = ARGV[6], b
+end
+redis.call('ZREM', KEYS[1], winner)
+forget({winner})
+record({winner, score})
+return {winner, score}
+`)
+
+// DequeueBetter removes and returns whichever of the two members would be
+// dequeued first: the one with the lower score or, on ties, the one Redis
+// orders first. The loser stays in the queue. The winner is recorded as
+// dequeued.
+//
+// Both scores are compared and the winner removed and recorded atomically in
+// a single Lua script.
+//
+// Returns:
+//   - The removed member.
+//   - ErrMemberNotFound if either member is not in the queue.
+//   - ErrInvalidRequest if the Service is created with WithDequeueCooldown.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DequeueBetter(ctx context.Context, queueID, memberA, memberB string) (string, error) {
+	if err := q.rejectCooldown("DequeueBetter"); err != nil {
+		return "", err
+	}
+
+	reply, err := dequeueBetterScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(queueID),
+		q.dequeueArgs(true, q.member(memberA), q.member(memberB))...,
+	).
+		StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrMemberNotFound
+	}
+	if err != nil {
+		return "", q.queueErr(ctx, queueID, err)
+	}
+	if len(reply) != 2 {
+		return "", fmt.Errorf("unexpected reply length %d", len(reply))
+	}
+	return reply[0], nil
+}
@@ -0,0 +1,51 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDequeueBetter(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	scores := map[string]float64{"a": 2, "b": 1, "x": 5, "y": 5}
+	for id, score := range scores {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"a", "b", "b"},
+		// Ties go to the lexically smaller ID, whatever the argument order.
+		{"y", "x", "x"},
+	}
+	for _, tt := range tests {
+		winner, err := q.DequeueBetter(ctx, "jobs", tt.a, tt.b)
+		if err != nil || winner != tt.want {
+			t.Fatalf("DequeueBetter(%s, %s) = %q, %v; want %q", tt.a, tt.b, winner, err, tt.want)
+		}
+		if dequeued, err := q.IsDequeued(ctx, "jobs", winner); err != nil || !dequeued {
+			t.Errorf("IsDequeued(%s) = %v, %v; want true", winner, dequeued, err)
+		}
+		if ok, err := q.Contains(ctx, "jobs", winner); err != nil || ok {
+			t.Errorf("Contains(%s) = %v, %v; want false", winner, ok, err)
+		}
+	}
+
+	// b was dequeued above, so a stays in the queue.
+	if _, err := q.DequeueBetter(ctx, "jobs", "a", "b"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("DequeueBetter with a missing member: %v; want ErrMemberNotFound", err)
+	}
+	if ok, err := q.Contains(ctx, "jobs", "a"); err != nil || !ok {
+		t.Fatalf("Contains(a) = %v, %v; want true", ok, err)
+	}
+}
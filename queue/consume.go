@@ -0,0 +1,241 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// consumeBlockTimeout bounds each BZPOPMIN issued by Consume, so that
+	// cancellation is noticed even on an idle queue.
+	consumeBlockTimeout = time.Second
+
+	// consumeRetryDelay is the pause Consume makes after a failed pop.
+	consumeRetryDelay = time.Second
+)
+
+// ConsumeReq represents a request to consume a queue with ConsumeWith.
+type ConsumeReq struct {
+	// ID is the unique identifier of the queue.
+	ID string
+
+	// BufferSize is the capacity of the returned channel. Negative values are
+	// treated as 0.
+	BufferSize int
+
+	// OnError, when set, is called from the consuming goroutine with every
+	// error met while consuming. Transient errors are retried after a short
+	// pause; permanent ones, such as a queue key holding a value of the wrong
+	// type, stop the consumption and close the channel.
+	OnError func(error)
+
+	// Drain, when set, stops the consumption once closed: no new member is
+	// popped, a member popped but not delivered yet is put back, and the
+	// channel is closed. It is noticed within a second.
+	Drain <-chan struct{}
+}
+
+// Consume returns a channel delivering the members of the queue one at a time
+// in priority order, blocking on BZPOPMIN while the queue is empty. The
+// channel is closed when ctx is cancelled.
+//
+// It is ConsumeWith without an error callback: errors met while consuming are
+// retried or, if permanent, silently close the channel.
+//
+// Returns:
+//   - A channel of dequeued members.
+//   - ErrInvalidRequest if the Service is created with WithDequeueCooldown.
+//   - ErrQueueCleared if the queue is cleared and the Service refuses to
+//     dequeue from cleared queues.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Consume(ctx context.Context, queueID string, bufferSize int) (<-chan string, error) {
+	return q.ConsumeWith(ctx, &ConsumeReq{
+		ID:         queueID,
+		BufferSize: bufferSize,
+	})
+}
+
+// ConsumeWith returns a channel delivering the members of the queue one at a
+// time in priority order, blocking on BZPOPMIN while the queue is empty. The
+// channel is closed when ctx is cancelled, in.Drain is closed or a permanent
+// error occurs.
+//
+// A member is popped only once the previous one was accepted by the channel,
+// so at most in.BufferSize+1 members are out of the queue waiting to be
+// received. Delivered members are recorded as dequeued. A member popped but
+// not delivered when ctx is cancelled or in.Drain is closed is put back at
+// its score, as is a member that could not be recorded; members still
+// buffered in the channel when it is closed are left to the receiver, which
+// can put them back with RequeuePreservingScore. Failed pops and records are
+// retried after a short pause, and every error is passed to in.OnError.
+//
+// Returns:
+//   - A channel of dequeued members.
+//   - ErrInvalidRequest if the Service is created with WithDequeueCooldown.
+//   - ErrQueueCleared if the queue is cleared and the Service refuses to
+//     dequeue from cleared queues.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ConsumeWith(ctx context.Context, in *ConsumeReq) (<-chan string, error) {
+	if err := q.rejectCooldown("ConsumeWith"); err != nil {
+		return nil, err
+	}
+	if err := q.checkCleared(ctx, in.ID); err != nil {
+		return nil, err
+	}
+	bufferSize := max(in.BufferSize, 0)
+	report := func(err error) {
+		if in.OnError != nil {
+			in.OnError(err)
+		}
+	}
+
+	members := make(chan string, bufferSize)
+	go func() {
+		defer close(members)
+
+		retry := time.NewTimer(consumeRetryDelay)
+		retry.Stop()
+		defer retry.Stop()
+
+		// fail reports err and waits before the next attempt. It returns false
+		// when consuming must stop, because err is permanent, ctx is done or
+		// in.Drain is closed.
+		fail := func(err error) bool {
+			err = q.queueErr(ctx, in.ID, err)
+			report(err)
+			if errors.Is(err, ErrKeyTypeConflict) {
+				return false
+			}
+			retry.Reset(consumeRetryDelay)
+			select {
+			case <-ctx.Done():
+				return false
+			case <-in.Drain:
+				return false
+			case <-retry.C:
+				return true
+			}
+		}
+
+		draining := func() bool {
+			select {
+			case <-in.Drain:
+				return true
+			default:
+				return false
+			}
+		}
+
+		for ctx.Err() == nil && !draining() {
+			popped, err := q.redisClient.
+				BZPopMin(
+					ctx,
+					consumeBlockTimeout,
+					fmt.Sprintf(queueKey, in.ID),
+				).
+				Result()
+			if errors.Is(err, redis.Nil) || (err != nil && ctx.Err() != nil) {
+				continue
+			}
+			if err != nil {
+				if !fail(err) {
+					return
+				}
+				continue
+			}
+
+			z := popped.Z
+			if err := q.recordDequeued(ctx, in.ID, []redis.Z{z}); err != nil {
+				if err := q.redisClient.ZAdd(context.WithoutCancel(ctx), popped.Key, z).Err(); err != nil {
+					report(q.queueErr(ctx, in.ID, err))
+				}
+				if !fail(err) {
+					return
+				}
+				continue
+			}
+
+			select {
+			case members <- z.Member.(string):
+				continue
+			case <-ctx.Done():
+			case <-in.Drain:
+			}
+			if err := q.requeueStored(context.WithoutCancel(ctx), in.ID, z.Member.(string)); err != nil {
+				report(err)
+			}
+			return
+		}
+	}()
+
+	return members, nil
+}
+
+// BlockingDequeue removes the head of the queue, blocking with BZPOPMIN until
+// an item is available, timeout elapses or ctx is cancelled. A timeout <= 0
+// waits until ctx is cancelled. The item is recorded as dequeued like with
+// Dequeue.
+//
+// A single item is popped with BZPOPMIN, bypassing the multi-item Dequeue
+// path: DequeueReq.MinScore, WithDequeueRetryUntilFull and the batch size
+// statistics of DequeueSizeStats do not apply.
+//
+// The wait is split in BZPOPMIN calls of one second, the smallest timeout
+// BZPOPMIN accepts through the client, so a cancelled ctx is noticed within a
+// second and the timeout is only checked between calls: the call can wait up
+// to a second longer than timeout.
+//
+// Returns:
+//   - The dequeued member and its score, also when recording it as dequeued
+//     fails, since it is out of the queue already.
+//   - ErrDequeueTimeout if no item became available within timeout.
+//   - ErrInvalidRequest if the Service is created with WithDequeueCooldown.
+//   - ErrQueueCleared if the queue is cleared and the Service refuses to
+//     dequeue from cleared queues.
+//   - The context error if ctx is cancelled.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) BlockingDequeue(ctx context.Context, queueID string, timeout time.Duration) (ScoredMember, error) {
+	if err := q.rejectCooldown("BlockingDequeue"); err != nil {
+		return ScoredMember{}, err
+	}
+	if err := q.checkCleared(ctx, queueID); err != nil {
+		return ScoredMember{}, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if timeout > 0 && !time.Now().Before(deadline) {
+			return ScoredMember{}, ErrDequeueTimeout
+		}
+
+		popped, err := q.redisClient.
+			BZPopMin(
+				ctx,
+				consumeBlockTimeout,
+				fmt.Sprintf(queueKey, queueID),
+			).
+			Result()
+		if ctxErr := ctx.Err(); ctxErr != nil && popped == nil {
+			return ScoredMember{}, ctxErr
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return ScoredMember{}, q.queueErr(ctx, queueID, err)
+		}
+
+		// The item is out of the queue already, so record it even if ctx
+		// was cancelled in the meantime.
+		z := popped.Z
+		err = q.recordDequeued(context.WithoutCancel(ctx), queueID, []redis.Z{z})
+		return ScoredMember{
+			MemberID: z.Member.(string),
+			Score:    z.Score,
+		}, q.queueErr(ctx, queueID, err)
+	}
+}
@@ -0,0 +1,130 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestBlockingDequeue(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a", Score: 3})
+	}()
+
+	got, err := q.BlockingDequeue(ctx, "jobs", 5*time.Second)
+	if err != nil {
+		t.Fatalf("BlockingDequeue: %v", err)
+	}
+	if got.MemberID != "a" || got.Score != 3 {
+		t.Fatalf("BlockingDequeue = %+v; want a at 3", got)
+	}
+	dequeued, err := q.IsDequeued(ctx, "jobs", "a")
+	if err != nil || !dequeued {
+		t.Fatalf("IsDequeued = %v, %v; want true", dequeued, err)
+	}
+}
+
+func TestBlockingDequeueTimeout(t *testing.T) {
+	q, _ := queuetest.NewTestService(t)
+
+	_, err := q.BlockingDequeue(context.Background(), "jobs", 100*time.Millisecond)
+	if !errors.Is(err, queue.ErrDequeueTimeout) {
+		t.Fatalf("BlockingDequeue = %v; want ErrDequeueTimeout", err)
+	}
+}
+
+func TestBlockingDequeueRecordFailureReturnsMember(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := h.Client.Set(ctx, "dequeue:jobs", "x", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := q.BlockingDequeue(ctx, "jobs", time.Second)
+	if err == nil {
+		t.Fatal("BlockingDequeue succeeded; want the record error")
+	}
+	if got.MemberID != "a" {
+		t.Fatalf("BlockingDequeue = %+v; want a along with the error", got)
+	}
+}
+
+func TestConsumeDeliversInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, _ := queuetest.NewTestService(t)
+
+	want := []string{"a", "b", "c", "d"}
+	for i, id := range want {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	members, err := q.Consume(ctx, "jobs", 1)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	for _, id := range want {
+		select {
+		case got := <-members:
+			if got != id {
+				t.Fatalf("Consume delivered %q; want %q", got, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", id)
+		}
+	}
+
+	cancel()
+	for range members {
+	}
+	total, err := q.LifetimeDequeued(context.Background(), "jobs")
+	if err != nil || total != int64(len(want)) {
+		t.Fatalf("LifetimeDequeued = %d, %v; want %d", total, err, len(want))
+	}
+}
+
+func TestConsumeWithStopsOnPermanentError(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := h.Client.Set(ctx, "queue:jobs", "x", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	errs := make(chan error, 10)
+	members, err := q.ConsumeWith(ctx, &queue.ConsumeReq{
+		ID:      "jobs",
+		OnError: func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("ConsumeWith: %v", err)
+	}
+
+	select {
+	case _, ok := <-members:
+		if ok {
+			t.Fatal("ConsumeWith delivered a member from a broken queue")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConsumeWith did not stop on a permanent error")
+	}
+	if err := <-errs; !errors.Is(err, queue.ErrKeyTypeConflict) {
+		t.Fatalf("OnError got %v; want ErrKeyTypeConflict", err)
+	}
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// Handler processes a single dequeued member. It should return promptly once
+// ctx is cancelled. A member whose handler returns an error is put back in the
+// queue at the score it had when it was dequeued.
+type Handler func(ctx context.Context, member string) error
+
+// Consumer consumes a queue with ConsumeWith and passes every member to a
+// Handler, one at a time, until its context is cancelled or it is drained.
+type Consumer struct {
+	q          *Service
+	queueID    string
+	bufferSize int
+	handler    Handler
+
+	mu       sync.Mutex
+	started  bool
+	abort    context.CancelFunc
+	draining chan struct{}
+	drain    sync.Once
+	done     chan struct{}
+}
+
+// NewConsumer returns a Consumer of the specified queue, letting up to
+// bufferSize members wait behind the one being handled.
+func (q *Service) NewConsumer(queueID string, bufferSize int, handler Handler) *Consumer {
+	return &Consumer{
+		q:          q,
+		queueID:    queueID,
+		bufferSize: bufferSize,
+		handler:    handler,
+		draining:   make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Run consumes the queue until ctx is cancelled, Drain is called or a
+// permanent error occurs. It must be called at most once.
+//
+// Handled members are recorded as dequeued. Members whose handler failed, and
+// members taken from the queue but not handled when Run stops, are put back in
+// the queue at the score they had when they were dequeued.
+//
+// Returns:
+//   - nil once drained.
+//   - The context error if ctx is cancelled.
+//   - ErrInvalidRequest if the Service is created with WithDequeueCooldown.
+//   - The error that stopped the consumption, or an error if a member could
+//     not be put back in the queue.
+func (c *Consumer) Run(ctx context.Context) error {
+	handlerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	c.started = true
+	c.abort = cancel
+	c.mu.Unlock()
+	defer close(c.done)
+
+	// OnError runs on the consuming goroutine before it closes the channel,
+	// so lastErr can be read once the channel is drained.
+	var lastErr error
+	members, err := c.q.ConsumeWith(ctx, &ConsumeReq{
+		ID:         c.queueID,
+		BufferSize: c.bufferSize,
+		OnError:    func(err error) { lastErr = err },
+		Drain:      c.draining,
+	})
+	if err != nil {
+		return err
+	}
+
+	var requeueErr error
+	for member := range members {
+		if !c.isDraining() && handlerCtx.Err() == nil && c.handler(handlerCtx, member) == nil {
+			continue
+		}
+		if err := c.q.requeueStored(context.WithoutCancel(ctx), c.queueID, member); err != nil && requeueErr == nil {
+			requeueErr = err
+		}
+	}
+
+	switch {
+	case requeueErr != nil:
+		return requeueErr
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case c.isDraining():
+		return nil
+	default:
+		return lastErr
+	}
+}
+
+// Drain stops the consumer from dequeuing new members and waits for the
+// member being handled to finish. Members taken from the queue but not
+// started yet are requeued. Since the consumer may be blocked waiting for a
+// member, stopping can take up to a second.
+//
+// If ctx expires before the consumer stops, the handler's context is cancelled
+// and the member being handled is requeued as well, unless its handler still
+// returns nil. Drain is meant to be called from a shutdown handler with a
+// grace period deadline.
+//
+// Returns:
+//   - nil if the consumer stopped within the grace period.
+//   - The context error if the grace period expired.
+func (c *Consumer) Drain(ctx context.Context) error {
+	c.drain.Do(func() {
+		close(c.draining)
+	})
+
+	c.mu.Lock()
+	started, abort := c.started, c.abort
+	c.mu.Unlock()
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		abort()
+		<-c.done
+		return ctx.Err()
+	}
+}
+
+// isDraining reports whether Drain was called.
+func (c *Consumer) isDraining() bool {
+	select {
+	case <-c.draining:
+		return true
+	default:
+		return false
+	}
+}
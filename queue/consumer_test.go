@@ -0,0 +1,96 @@
+package queue_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestConsumerDrainRequeuesUnfinished(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	started := make(chan string, 4)
+	release := make(chan struct{})
+	c := q.NewConsumer("jobs", 1, func(ctx context.Context, member string) error {
+		started <- member
+		<-release
+		return nil
+	})
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- c.Run(ctx) }()
+
+	if got := <-started; got != "a" {
+		t.Fatalf("first handled member = %q; want a", got)
+	}
+	// Give the consumer time to pop the members waiting behind a.
+	time.Sleep(100 * time.Millisecond)
+
+	drainErr := make(chan error, 1)
+	go func() {
+		grace, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		drainErr <- c.Drain(grace)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-drainErr; err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(started) != 0 {
+		t.Fatalf("handler started %q after Drain", <-started)
+	}
+
+	queued, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRange: %v", err)
+	}
+	if want := []string{"b", "c", "d"}; !slices.Equal(queued, want) {
+		t.Fatalf("queued after Drain = %v; want %v", queued, want)
+	}
+}
+
+func TestConsumerDrainGracePeriodExpires(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	started := make(chan struct{})
+	c := q.NewConsumer("jobs", 0, func(ctx context.Context, member string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	go c.Run(ctx)
+	<-started
+
+	grace, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := c.Drain(grace); err == nil {
+		t.Fatal("Drain succeeded; want the grace period error")
+	}
+
+	ok, err := q.Contains(ctx, "jobs", "a")
+	if err != nil || !ok {
+		t.Fatalf("Contains(a) = %v, %v; want true", ok, err)
+	}
+}
@@ -0,0 +1,12 @@
+package queue
+
+import "fmt"
+
+// rejectCooldown returns ErrInvalidRequest for the methods that cannot skip
+// members when the Service is created with WithDequeueCooldown.
+func (q *Service) rejectCooldown(method string) error {
+	if q.cooldown <= 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s does not support WithDequeueCooldown", ErrInvalidRequest, method)
+}
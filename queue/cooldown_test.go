@@ -0,0 +1,95 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDequeueCooldown(t *testing.T) {
+	ctx := context.Background()
+	const cooldown = 200 * time.Millisecond
+	q, _ := queuetest.NewTestService(t, queue.WithDequeueCooldown(cooldown))
+
+	enqueue := func(id string, score float64) {
+		t.Helper()
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: score}); err != nil {
+			t.Fatalf("Enqueue(%s): %v", id, err)
+		}
+	}
+	enqueue("a", 1)
+	enqueue("b", 2)
+
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil || !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("Dequeue = %v, %v; want [a]", got, err)
+	}
+
+	// a is re-enqueued at the head while cooling down: every dequeue path
+	// skips it.
+	enqueue("a", 1)
+	enqueue("c", 3)
+	got, err = q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil || !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("Dequeue during cooldown = %v, %v; want [b]", got, err)
+	}
+	got, err = q.DequeueWithAck(ctx, "jobs", 1, time.Minute)
+	if err != nil || !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("DequeueWithAck during cooldown = %v, %v; want [c]", got, err)
+	}
+	if _, _, err := q.Lease(ctx, "jobs", time.Minute); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("Lease during cooldown: %v; want ErrQueueEmpty", err)
+	}
+
+	time.Sleep(cooldown + 50*time.Millisecond)
+	got, err = q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil || !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("Dequeue after cooldown = %v, %v; want [a]", got, err)
+	}
+}
+
+func TestDequeueCooldownLargeBatch(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t, queue.WithDequeueCooldown(time.Minute))
+
+	const items = 9000
+	batch := make([]queue.EnqueueItem, 0, items)
+	for i := 0; i < items; i++ {
+		batch = append(batch, queue.EnqueueItem{MemberID: fmt.Sprintf("m%05d", i), Score: float64(i)})
+	}
+	if _, err := q.EnqueueBatchDedup(ctx, "jobs", batch); err != nil {
+		t.Fatalf("EnqueueBatchDedup: %v", err)
+	}
+
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: items})
+	if err != nil || len(got) != items {
+		t.Fatalf("Dequeue = %d items, %v; want %d", len(got), err, items)
+	}
+}
+
+func TestDequeueCooldownRejected(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t, queue.WithDequeueCooldown(time.Minute))
+
+	if _, err := q.BlockingDequeue(ctx, "jobs", time.Second); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Errorf("BlockingDequeue: %v; want ErrInvalidRequest", err)
+	}
+	if _, err := q.Consume(ctx, "jobs", 0); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Errorf("Consume: %v; want ErrInvalidRequest", err)
+	}
+	if _, err := q.DequeueSharded(ctx, "jobs", 2, 1); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Errorf("DequeueSharded: %v; want ErrInvalidRequest", err)
+	}
+	if _, err := q.DequeueTopBand(ctx, "jobs", 0); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Errorf("DequeueTopBand: %v; want ErrInvalidRequest", err)
+	}
+	if _, err := q.DequeueBetter(ctx, "jobs", "a", "b"); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Errorf("DequeueBetter: %v; want ErrInvalidRequest", err)
+	}
+}
@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sendToDeadLetterScript removes the member ARGV[1] from the queue in KEYS[1],
+// from the dequeue tracking in KEYS[2], KEYS[3] and KEYS[4] and from the
+// enqueue times in KEYS[5], attempt counts in KEYS[8] and update counts in
+// KEYS[9], then adds it to the dead-letter queue in KEYS[6] scored by ARGV[2],
+// recording the reason ARGV[3] in KEYS[7]. It returns 0, without
+// dead-lettering anything, if the member was neither queued nor dequeued.
+var sendToDeadLetterScript = redis.NewScript(`
+local queued = redis.call('ZREM', KEYS[1], ARGV[1])
+local dequeued = redis.call('SREM', KEYS[2], ARGV[1])
+if queued == 0 and dequeued == 0 then
+	return 0
+end
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('HDEL', KEYS[5], ARGV[1])
+redis.call('HDEL', KEYS[8], ARGV[1])
+redis.call('HDEL', KEYS[9], ARGV[1])
+redis.call('ZADD', KEYS[6], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[7], ARGV[1], ARGV[3])
+return 1
+`)
+
+// DeadLetter represents an item of the dead-letter queue.
+type DeadLetter struct {
+	// MemberID is the unique identifier of the item.
+	MemberID string
+
+	// Reason is the reason the item was dead-lettered for. It is empty for
+	// items dead-lettered by RecoverExpiredToDLQ.
+	Reason string
+
+	// DeadLetteredAt is the time the item was dead-lettered.
+	DeadLetteredAt time.Time
+}
+
+// SendToDeadLetter moves a queued or dequeued member to the dead-letter queue
+// of the queue, recording why. The member is removed from the queue and from
+// the dequeue tracking atomically in a single Lua script.
+//
+// Returns:
+//   - ErrMemberNotFound if the member is neither queued nor dequeued.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) SendToDeadLetter(ctx context.Context, queueID, memberID, reason string) error {
+	moved, err := sendToDeadLetterScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(dequeueKey, queueID),
+			fmt.Sprintf(dequeueHistoryKey, queueID),
+			fmt.Sprintf(dequeuedScoreKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+			fmt.Sprintf(deadLetterKey, queueID),
+			fmt.Sprintf(deadLetterReasonKey, queueID),
+			fmt.Sprintf(attemptsKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		q.member(memberID),
+		time.Now().UnixMilli(),
+		reason,
+	).
+		Int()
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	if moved == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// ListDeadLetter returns the n most recently dead-lettered items of the queue,
+// most recent first, with their reason and dead-letter time.
+//
+// Returns:
+//   - A slice of DeadLetter, most recently dead-lettered first.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ListDeadLetter(ctx context.Context, queueID string, n int64) ([]DeadLetter, error) {
+	if n <= 0 {
+		return []DeadLetter{}, nil
+	}
+
+	entries, err := q.reader().
+		ZRevRangeWithScores(
+			ctx,
+			fmt.Sprintf(deadLetterKey, queueID),
+			0,
+			n-1,
+		).
+		Result()
+	if err != nil {
+		return []DeadLetter{}, err
+	}
+	if len(entries) == 0 {
+		return []DeadLetter{}, nil
+	}
+
+	reasons, err := q.reader().
+		HMGet(
+			ctx,
+			fmt.Sprintf(deadLetterReasonKey, queueID),
+			memberIDs(entries)...,
+		).
+		Result()
+	if err != nil {
+		return []DeadLetter{}, err
+	}
+
+	letters := make([]DeadLetter, 0, len(entries))
+	for i, z := range entries {
+		reason, _ := reasons[i].(string)
+		letters = append(letters, DeadLetter{
+			MemberID:       z.Member.(string),
+			Reason:         reason,
+			DeadLetteredAt: time.UnixMilli(int64(z.Score)),
+		})
+	}
+	return letters, nil
+}
+
+// retryFromDeadLetterScript moves the member ARGV[1] from the dead-letter
+// queue in KEYS[1] back to the queue in KEYS[3] at the score ARGV[2],
+// dropping its reason in KEYS[2] and recording ARGV[3] as its enqueue time in
+// KEYS[4] unless one is recorded already. It returns 0 if the member is not
+// dead-lettered.
+var retryFromDeadLetterScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[2], ARGV[1])
+redis.call('HSETNX', KEYS[4], ARGV[1], ARGV[3])
+return 1
+`)
+
+// RetryFromDeadLetter moves a dead-lettered member back to the queue at the
+// given score, dropping its recorded reason. The move happens atomically in a
+// single Lua script.
+//
+// Returns:
+//   - ErrMemberNotFound if the member is not in the dead-letter queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RetryFromDeadLetter(ctx context.Context, queueID, memberID string, score float64) error {
+	if err := q.validateScore(score); err != nil {
+		return err
+	}
+
+	moved, err := retryFromDeadLetterScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(deadLetterKey, queueID),
+			fmt.Sprintf(deadLetterReasonKey, queueID),
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		q.member(memberID),
+		formatScore(score),
+		time.Now().UnixMilli(),
+	).
+		Int()
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	if moved == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestSendToDeadLetterAndList(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+
+	before := time.Now()
+	if err := q.SendToDeadLetter(ctx, "jobs", "a", "handler panicked"); err != nil {
+		t.Fatalf("SendToDeadLetter(a): %v", err)
+	}
+	// Dead-letter b in a later millisecond so the listing order is strict.
+	time.Sleep(2 * time.Millisecond)
+	if err := q.SendToDeadLetter(ctx, "jobs", "b", "invalid payload"); err != nil {
+		t.Fatalf("SendToDeadLetter(b): %v", err)
+	}
+	if err := q.SendToDeadLetter(ctx, "jobs", "missing", "x"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("SendToDeadLetter of a missing member: %v; want ErrMemberNotFound", err)
+	}
+
+	if ok, err := q.Contains(ctx, "jobs", "b"); err != nil || ok {
+		t.Fatalf("Contains(b) = %v, %v; want false once dead-lettered", ok, err)
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "a"); err != nil || dequeued {
+		t.Fatalf("IsDequeued(a) = %v, %v; want false once dead-lettered", dequeued, err)
+	}
+
+	letters, err := q.ListDeadLetter(ctx, "jobs", 10)
+	if err != nil || len(letters) != 2 {
+		t.Fatalf("ListDeadLetter = %v, %v; want 2 entries", letters, err)
+	}
+	want := []struct{ member, reason string }{{"b", "invalid payload"}, {"a", "handler panicked"}}
+	for i, w := range want {
+		if letters[i].MemberID != w.member || letters[i].Reason != w.reason {
+			t.Errorf("ListDeadLetter[%d] = %+v; want %s with reason %q", i, letters[i], w.member, w.reason)
+		}
+		if letters[i].DeadLetteredAt.Before(before.Truncate(time.Millisecond)) || letters[i].DeadLetteredAt.After(time.Now()) {
+			t.Errorf("DeadLetteredAt of %s = %v; want between %v and now", w.member, letters[i].DeadLetteredAt, before)
+		}
+	}
+
+	if letters, err := q.ListDeadLetter(ctx, "jobs", 1); err != nil || len(letters) != 1 || letters[0].MemberID != "b" {
+		t.Fatalf("ListDeadLetter(1) = %v, %v; want only b", letters, err)
+	}
+}
+
+func TestRetryFromDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i + 1)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if err := q.SendToDeadLetter(ctx, "jobs", "b", "timeout"); err != nil {
+		t.Fatalf("SendToDeadLetter: %v", err)
+	}
+
+	if err := q.RetryFromDeadLetter(ctx, "jobs", "b", 0); err != nil {
+		t.Fatalf("RetryFromDeadLetter: %v", err)
+	}
+	if head, err := q.PeekByQueueID(ctx, "jobs"); err != nil || head != "b" {
+		t.Fatalf("PeekByQueueID = %q, %v; want the retried b at its new score", head, err)
+	}
+	if letters, err := q.ListDeadLetter(ctx, "jobs", 10); err != nil || len(letters) != 0 {
+		t.Fatalf("ListDeadLetter after the retry = %v, %v; want none", letters, err)
+	}
+	if ok, err := h.Client.HExists(ctx, "dlq_reason:jobs", "b").Result(); err != nil || ok {
+		t.Fatalf("reason of the retried member kept = %v, %v; want false", ok, err)
+	}
+
+	if err := q.RetryFromDeadLetter(ctx, "jobs", "b", 0); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("second RetryFromDeadLetter: %v; want ErrMemberNotFound", err)
+	}
+}
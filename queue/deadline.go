@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TimeUntilNextDue treats scores as deadlines in unix milliseconds and returns
+// how long until the head item is due, relative to now, along with the head
+// member. The duration is negative if the head is overdue, which lets
+// schedulers sleep precisely until the next item.
+//
+// Returns:
+//   - The time left until the head is due, and the head member.
+//   - ErrQueueEmpty if the queue is empty.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) TimeUntilNextDue(ctx context.Context, queueID string, now time.Time) (time.Duration, string, error) {
+	head, err := q.reader().
+		ZRangeWithScores(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			0,
+			0,
+		).
+		Result()
+	if err != nil {
+		return 0, "", q.queueErr(ctx, queueID, err)
+	}
+	if len(head) == 0 {
+		return 0, "", ErrQueueEmpty
+	}
+
+	deadline := time.UnixMilli(int64(math.Round(head[0].Score)))
+	return deadline.Sub(now), head[0].Member.(string), nil
+}
+
+// enqueueDeadlineBoundedScript adds the member ARGV[1] with score ARGV[2] to
+// the queue in KEYS[1], recording the enqueue time ARGV[4] in KEYS[2], and, if
+// the queue then holds more than ARGV[3] members, removes and returns the
+// members in excess from the tail, dropping their enqueue times, their
+// attempt counts in KEYS[3] and their update counts in KEYS[4].
+var enqueueDeadlineBoundedScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[4])
+local excess = redis.call('ZCARD', KEYS[1]) - tonumber(ARGV[3])
+if excess <= 0 then
+	return {}
+end
+local evicted = redis.call('ZRANGE', KEYS[1], -excess, -1)
+redis.call('ZREMRANGEBYRANK', KEYS[1], -excess, -1)
+for _, member in ipairs(evicted) do
+	redis.call('HDEL', KEYS[2], member)
+	redis.call('HDEL', KEYS[3], member)
+	redis.call('HDEL', KEYS[4], member)
+end
+return evicted
+`)
+
+// EnqueueDeadlineBounded adds an item scored by its deadline in unix
+// milliseconds and, if the queue then holds more than maxLen items, evicts the
+// items with the latest deadlines, which may include the new item itself. This
+// keeps the maxLen most urgent items.
+//
+// The insert and the eviction happen atomically in a single Lua script.
+// Evicted items are not recorded as dequeued.
+//
+// Returns:
+//   - The evicted members, latest deadline last.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueDeadlineBounded(ctx context.Context, queueID, memberID string, deadline time.Time, maxLen int64) ([]string, error) {
+	score := float64(deadline.UnixMilli())
+	if err := q.validateScore(score); err != nil {
+		return []string{}, err
+	}
+	if maxLen < 0 {
+		maxLen = 0
+	}
+
+	evicted, err := enqueueDeadlineBoundedScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+			fmt.Sprintf(attemptsKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		q.member(memberID),
+		score,
+		maxLen,
+		time.Now().UnixMilli(),
+	).
+		StringSlice()
+	if err != nil {
+		return []string{}, q.queueErr(ctx, queueID, err)
+	}
+	return evicted, nil
+}
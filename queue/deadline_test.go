@@ -0,0 +1,75 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestTimeUntilNextDue(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	now := time.UnixMilli(1_700_000_000_000)
+	if _, _, err := q.TimeUntilNextDue(ctx, "jobs", now); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("TimeUntilNextDue on an empty queue: %v; want ErrQueueEmpty", err)
+	}
+
+	for member, due := range map[string]time.Time{"later": now.Add(time.Hour), "soon": now.Add(90 * time.Second)} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: member, Score: float64(due.UnixMilli())}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	wait, head, err := q.TimeUntilNextDue(ctx, "jobs", now)
+	if err != nil || head != "soon" || wait != 90*time.Second {
+		t.Fatalf("TimeUntilNextDue = %v, %q, %v; want 1m30s, soon", wait, head, err)
+	}
+
+	overdue := now.Add(-2 * time.Second)
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "overdue", Score: float64(overdue.UnixMilli())}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	wait, head, err = q.TimeUntilNextDue(ctx, "jobs", now)
+	if err != nil || head != "overdue" || wait != -2*time.Second {
+		t.Fatalf("TimeUntilNextDue = %v, %q, %v; want -2s, overdue", wait, head, err)
+	}
+}
+
+func TestEnqueueDeadlineBoundedEvictsLatest(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	now := time.UnixMilli(1_700_000_000_000)
+	steps := []struct {
+		member  string
+		due     time.Duration
+		maxLen  int64
+		evicted []string
+	}{
+		{"a", 3 * time.Minute, 2, []string{}},
+		{"b", time.Minute, 2, []string{}},
+		{"c", 2 * time.Minute, 2, []string{"a"}},
+		{"d", 10 * time.Minute, 2, []string{"d"}},
+		{"e", 30 * time.Second, 1, []string{"b", "c"}},
+	}
+	for _, step := range steps {
+		evicted, err := q.EnqueueDeadlineBounded(ctx, "jobs", step.member, now.Add(step.due), step.maxLen)
+		if err != nil || !slices.Equal(evicted, step.evicted) {
+			t.Fatalf("EnqueueDeadlineBounded(%s) = %v, %v; want %v", step.member, evicted, err, step.evicted)
+		}
+	}
+
+	members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || !slices.Equal(members, []string{"e"}) {
+		t.Fatalf("queue = %v, %v; want [e]", members, err)
+	}
+	if n, err := h.Client.HLen(ctx, "enqueued_at:jobs").Result(); err != nil || n != 1 {
+		t.Fatalf("recorded enqueue times = %d, %v; want only e's", n, err)
+	}
+}
@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DecayModel defines how the score of a decaying item drifts over time, where
+// elapsed is the number of seconds since the item was last refreshed.
+type DecayModel int
+
+const (
+	// DecayLinear scores items as base + rate*elapsed.
+	DecayLinear DecayModel = iota
+
+	// DecayExponential scores items as base * e^(rate*elapsed). It is only
+	// meaningful for positive base scores.
+	DecayExponential
+)
+
+// refreshPriorityScript records the member ARGV[1] of the queue in KEYS[1] as
+// touched at ARGV[3] with the decay rate ARGV[2] in KEYS[2], and resets its
+// score to its base score. The base score is the current score the first time
+// the member is refreshed. It returns 0 if the member is not in the queue.
+var refreshPriorityScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+	return 0
+end
+local base = score
+local record = redis.call('HGET', KEYS[2], ARGV[1])
+if record then
+	base = string.match(record, '^([^|]+)')
+end
+redis.call('HSET', KEYS[2], ARGV[1], base .. '|' .. ARGV[3] .. '|' .. ARGV[2])
+redis.call('ZADD', KEYS[1], base, ARGV[1])
+return 1
+`)
+
+// decayPrioritiesScript recomputes, at time ARGV[1], the score of every
+// decaying member recorded in KEYS[2] that is still in the queue in KEYS[1],
+// using the exponential model when ARGV[2] is 1 and the linear one otherwise.
+// Records of members no longer in the queue are removed.
+var decayPrioritiesScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local exponential = ARGV[2] == '1'
+local records = redis.call('HGETALL', KEYS[2])
+local decayed = 0
+for i = 1, #records, 2 do
+	local member = records[i]
+	if redis.call('ZSCORE', KEYS[1], member) then
+		local base, touched, rate = string.match(records[i + 1], '^([^|]+)|([^|]+)|([^|]+)$')
+		local elapsed = (now - tonumber(touched)) / 1000
+		if elapsed < 0 then
+			elapsed = 0
+		end
+		local score
+		if exponential then
+			score = tonumber(base) * math.exp(tonumber(rate) * elapsed)
+		else
+			score = tonumber(base) + tonumber(rate) * elapsed
+		end
+		redis.call('ZADD', KEYS[1], score, member)
+		decayed = decayed + 1
+	else
+		redis.call('HDEL', KEYS[2], member)
+	end
+end
+return decayed
+`)
+
+// RefreshPriority marks a member as touched at now and restores its base
+// priority, so that it holds its position until it decays again.
+//
+// The first refresh adopts the member's current score as its base score and
+// starts its decay at decayRate per second; later refreshes update the touch
+// time and rate. The score then drifts towards the back of the queue on every
+// DecayPriorities sweep, following the Service's DecayModel. Calling
+// SetPriority on the member stops its decay until it is refreshed again, with
+// the new score as base.
+//
+// Returns:
+//   - ErrMemberNotFound if the member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RefreshPriority(ctx context.Context, queueID, memberID string, decayRate float64, now time.Time) error {
+	refreshed, err := refreshPriorityScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(decayKey, queueID),
+		},
+		q.member(memberID),
+		decayRate,
+		now.UnixMilli(),
+	).
+		Int()
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	if refreshed == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// DecayPriorities recomputes the score of every decaying member of the queue
+// from its base score and the time elapsed between its last refresh and now.
+// It is meant to be called periodically.
+//
+// Returns:
+//   - The number of members whose score was recomputed.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DecayPriorities(ctx context.Context, queueID string, now time.Time) (int64, error) {
+	exponential := 0
+	if q.decayModel == DecayExponential {
+		exponential = 1
+	}
+
+	decayed, err := decayPrioritiesScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(decayKey, queueID),
+		},
+		now.UnixMilli(),
+		exponential,
+	).
+		Int64()
+	return decayed, q.queueErr(ctx, queueID, err)
+}
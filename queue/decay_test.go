@@ -0,0 +1,76 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDecayPrioritiesUntouchedMemberFallsBehind(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	t0 := time.Unix(1_700_000_000, 0)
+	if err := q.RefreshPriority(ctx, "jobs", "a", 1, t0); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("RefreshPriority of a missing member: %v; want ErrMemberNotFound", err)
+	}
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i + 1)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := q.RefreshPriority(ctx, "jobs", id, 1, t0); err != nil {
+			t.Fatalf("RefreshPriority(%s): %v", id, err)
+		}
+	}
+
+	// Five simulated seconds later only b is refreshed, so a decays from its
+	// base score while b is restored to it.
+	later := t0.Add(5 * time.Second)
+	if err := q.RefreshPriority(ctx, "jobs", "b", 1, later); err != nil {
+		t.Fatalf("RefreshPriority(b): %v", err)
+	}
+	decayed, err := q.DecayPriorities(ctx, "jobs", later)
+	if err != nil || decayed != 2 {
+		t.Fatalf("DecayPriorities = %d, %v; want 2", decayed, err)
+	}
+
+	members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || !slices.Equal(members, []string{"b", "c", "a"}) {
+		t.Fatalf("queue = %v, %v; want [b c a]", members, err)
+	}
+	if score, err := h.Client.ZScore(ctx, "queue:jobs", "a").Result(); err != nil || score != 6 {
+		t.Fatalf("score of a = %v, %v; want 6", score, err)
+	}
+}
+
+func TestDecayPrioritiesExponential(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t, queue.WithDecayModel(queue.DecayExponential))
+	q := h.Service
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a", Score: 2}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	t0 := time.Unix(1_700_000_000, 0)
+	if err := q.RefreshPriority(ctx, "jobs", "a", math.Ln2, t0); err != nil {
+		t.Fatalf("RefreshPriority: %v", err)
+	}
+	if _, err := q.DecayPriorities(ctx, "jobs", t0.Add(2*time.Second)); err != nil {
+		t.Fatalf("DecayPriorities: %v", err)
+	}
+
+	score, err := h.Client.ZScore(ctx, "queue:jobs", "a").Result()
+	if err != nil || math.Abs(score-8) > 1e-9 {
+		t.Fatalf("score of a = %v, %v; want 8", score, err)
+	}
+}
@@ -0,0 +1,540 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// enqueueAndTierRankScript adds the member ARGV[1] with score ARGV[2] to the
+// queue in KEYS[1], recording the enqueue time ARGV[3] in KEYS[2], and returns
+// the number of distinct scores lower than ARGV[2].
+var enqueueAndTierRankScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[3])
+local ahead = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[2], 'WITHSCORES')
+local tiers = 0
+local last = nil
+for i = 2, #ahead, 2 do
+	if ahead[i] ~= last then
+		tiers = tiers + 1
+		last = ahead[i]
+	end
+end
+return tiers
+`)
+
+// EnqueueAndTierRank adds an item to the queue like Enqueue and returns its
+// tier rank: the number of distinct priority scores ahead of it.
+//
+// Unlike the raw position, members sharing a score count as a single tier.
+// The insert and the count happen atomically in a single Lua script.
+//
+// Returns:
+//   - The number of distinct priority tiers ahead of the item.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueAndTierRank(ctx context.Context, in *EnqueueReq) (int64, error) {
+	score, err := q.compositeScore(in)
+	if err != nil {
+		return 0, err
+	}
+
+	tierRank, err := enqueueAndTierRankScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, in.ID),
+			fmt.Sprintf(enqueuedAtKey, in.ID),
+		},
+		q.member(in.MemberID),
+		score,
+		time.Now().UnixMilli(),
+	).
+		Int64()
+	return tierRank, q.queueErr(ctx, in.ID, err)
+}
+
+// enqueueIfBelowScript adds the member ARGV[1] with score ARGV[2] to the queue
+// in KEYS[1], recording the enqueue time ARGV[4] in KEYS[2], only if the queue
+// holds fewer than ARGV[3] members. It returns the ZADD reply: 1 if the
+// member was added, 0 if it was already queued and only rescored, or if the
+// queue is full.
+var enqueueIfBelowScript = redis.NewScript(`
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+local added = redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[4])
+return added
+`)
+
+// EnqueueIfBelow adds an item to the queue like Enqueue, but only if the queue
+// currently holds fewer than maxLen items. Nothing is evicted when the queue
+// is full: the item is simply refused. An item already in the queue is
+// rescored like with Enqueue, as long as the queue is not full.
+//
+// The length check and the insert happen atomically in a single Lua script.
+//
+// Returns:
+//   - true if the item was added, false if the queue is full or the item was
+//     already in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueIfBelow(ctx context.Context, in *EnqueueReq, maxLen int64) (bool, error) {
+	score, err := q.compositeScore(in)
+	if err != nil {
+		return false, err
+	}
+
+	added, err := enqueueIfBelowScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, in.ID),
+			fmt.Sprintf(enqueuedAtKey, in.ID),
+		},
+		q.member(in.MemberID),
+		score,
+		maxLen,
+		time.Now().UnixMilli(),
+	).
+		Int()
+	if err != nil {
+		return false, q.queueErr(ctx, in.ID, err)
+	}
+	return added == 1, nil
+}
+
+// enqueueIfEmptyScript adds the member ARGV[1] with score ARGV[2] to the queue
+// in KEYS[1], recording the enqueue time ARGV[3] in KEYS[2], only if the queue
+// is empty. It returns 1 if the member was added, 0 otherwise.
+var enqueueIfEmptyScript = redis.NewScript(`
+if redis.call('ZCARD', KEYS[1]) ~= 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+return 1
+`)
+
+// EnqueueIfEmpty adds an item to the queue like Enqueue, but only if the queue
+// is currently empty.
+//
+// The check and the insert happen atomically in a single Lua script, avoiding
+// the race of a separate length check followed by Enqueue.
+//
+// Returns:
+//   - true if the item was added, false if the queue is not empty.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueIfEmpty(ctx context.Context, in *EnqueueReq) (bool, error) {
+	score, err := q.compositeScore(in)
+	if err != nil {
+		return false, err
+	}
+
+	added, err := enqueueIfEmptyScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, in.ID),
+			fmt.Sprintf(enqueuedAtKey, in.ID),
+		},
+		q.member(in.MemberID),
+		score,
+		time.Now().UnixMilli(),
+	).
+		Int()
+	if err != nil {
+		return false, q.queueErr(ctx, in.ID, err)
+	}
+	return added == 1, nil
+}
+
+// placeBehindScript scores the member ARGV[1] of the queue in KEYS[1] at the
+// midpoint between the target member ARGV[2] and its successor, or one past
+// the target score when the target is the tail. When ARGV[3] is 1, the member
+// must already be in the queue. A new member gets the enqueue time ARGV[4] in
+// KEYS[2], while the update count of a queued one is incremented in KEYS[3].
+// It returns 0 if a required member is missing.
+var placeBehindScript = redis.NewScript(`
+local queued = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if ARGV[3] == '1' and not queued then
+	return 0
+end
+local target = redis.call('ZSCORE', KEYS[1], ARGV[2])
+if not target then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+local rank = redis.call('ZRANK', KEYS[1], ARGV[2])
+local successor = redis.call('ZRANGE', KEYS[1], rank + 1, rank + 1, 'WITHSCORES')
+local score
+if #successor > 0 then
+	score = (tonumber(target) + tonumber(successor[2])) / 2
+else
+	score = tonumber(target) + 1
+end
+redis.call('ZADD', KEYS[1], score, ARGV[1])
+if queued then
+	redis.call('HINCRBY', KEYS[3], ARGV[1], 1)
+else
+	redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[4])
+end
+return 1
+`)
+
+// EnqueueBehind adds an item to the queue immediately behind the target
+// member, scoring it at the midpoint between the target and the member right
+// after it, or one past the target score when the target is the tail. If the
+// item is already queued, it is moved.
+//
+// The scores are read and the item inserted atomically in a single Lua
+// script. Each midpoint insertion halves the gap between two neighbours, so
+// after about 50 repeated insertions between the same pair the scores can no
+// longer be told apart and the item falls back to lexical order among ties.
+//
+// Returns:
+//   - ErrMemberNotFound if the target member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueBehind(ctx context.Context, queueID, memberID, targetMemberID string) error {
+	return q.placeBehind(ctx, queueID, memberID, targetMemberID, false)
+}
+
+// placeBehind runs placeBehindScript, requiring the member to be queued
+// already when mustExist is set.
+func (q *Service) placeBehind(ctx context.Context, queueID, memberID, targetMemberID string, mustExist bool) error {
+	if memberID == targetMemberID {
+		return ErrInvalidRequest
+	}
+
+	required := 0
+	if mustExist {
+		required = 1
+	}
+	placed, err := placeBehindScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		q.member(memberID),
+		q.member(targetMemberID),
+		required,
+		time.Now().UnixMilli(),
+	).
+		Int()
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	if placed == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// FanOut enqueues the same member into every queue of targets, each at its own
+// score, using a single pipeline.
+//
+// Returns:
+//   - An error naming every queue the member could not be enqueued into;
+//     otherwise, nil.
+func (q *Service) FanOut(ctx context.Context, memberID string, targets map[string]float64) error {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	for _, score := range targets {
+		if err := q.validateScore(score); err != nil {
+			return err
+		}
+	}
+
+	member := q.member(memberID)
+	now := time.Now().UnixMilli()
+	pipe := q.redisClient.Pipeline()
+	cmds := make(map[string]*redis.IntCmd, len(targets))
+	for queueID, score := range targets {
+		cmds[queueID] = pipe.ZAdd(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			redis.Z{
+				Score:  score,
+				Member: member,
+			},
+		)
+		pipe.HSetNX(ctx, fmt.Sprintf(enqueuedAtKey, queueID), member, now)
+	}
+	_, execErr := pipe.Exec(ctx)
+	if execErr == nil {
+		return nil
+	}
+
+	var errs []error
+	for queueID, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("enqueue into queue %s: %w", queueID, q.queueErr(ctx, queueID, err)))
+		}
+	}
+	if len(errs) == 0 {
+		return execErr
+	}
+	return errors.Join(errs...)
+}
+
+// EnqueueWeighted adds an item to the queue with a score computed as the
+// weighted sum of its factors: sum(factors[k] * weights[k]).
+//
+// Factors are summed in lexical order of their names, so the same inputs
+// always produce the same score. The score is a float64: factors of very
+// different magnitudes lose precision, and items whose weighted sums differ by
+// less than the float64 resolution end up ordered lexically.
+//
+// Returns:
+//   - ErrInvalidRequest if a factor has no weight or the score is not finite.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueWeighted(ctx context.Context, queueID, memberID string, factors map[string]float64, weights map[string]float64) error {
+	names := make([]string, 0, len(factors))
+	for name := range factors {
+		if _, ok := weights[name]; !ok {
+			return fmt.Errorf("%w: no weight for factor %q", ErrInvalidRequest, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var score float64
+	for _, name := range names {
+		score += factors[name] * weights[name]
+	}
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return fmt.Errorf("%w: non-finite score %v", ErrInvalidRequest, score)
+	}
+
+	return q.Enqueue(ctx, &EnqueueReq{
+		ID:       queueID,
+		MemberID: memberID,
+		Score:    score,
+	})
+}
+
+// enqueueBoundedScript adds the member ARGV[1] with score ARGV[2] to the queue
+// in KEYS[1], recording the enqueue time ARGV[4] in KEYS[2], and, if the queue
+// then holds more than ARGV[3] members, removes and returns the tail member,
+// dropping its enqueue time, its attempt count in KEYS[3] and its update
+// count in KEYS[4]. It returns an empty string otherwise.
+var enqueueBoundedScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[4])
+if redis.call('ZCARD', KEYS[1]) <= tonumber(ARGV[3]) then
+	return ''
+end
+local tail = redis.call('ZRANGE', KEYS[1], -1, -1)
+redis.call('ZREM', KEYS[1], tail[1])
+redis.call('HDEL', KEYS[2], tail[1])
+redis.call('HDEL', KEYS[3], tail[1])
+redis.call('HDEL', KEYS[4], tail[1])
+return tail[1]
+`)
+
+// EnqueueBounded adds an item to the queue like Enqueue and, if the queue then
+// holds more than maxSize items, evicts the lowest-priority item, which may be
+// the new item itself. This keeps the best maxSize items.
+//
+// The insert and the eviction happen atomically in a single Lua script.
+// Evicted items are not recorded as dequeued.
+//
+// Returns:
+//   - The evicted member, or an empty string if nothing was evicted.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueBounded(ctx context.Context, in *EnqueueReq, maxSize int64) (string, error) {
+	score, err := q.compositeScore(in)
+	if err != nil {
+		return "", err
+	}
+
+	evicted, err := enqueueBoundedScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, in.ID),
+			fmt.Sprintf(enqueuedAtKey, in.ID),
+			fmt.Sprintf(attemptsKey, in.ID),
+			fmt.Sprintf(updateCountKey, in.ID),
+		},
+		q.member(in.MemberID),
+		score,
+		maxSize,
+		time.Now().UnixMilli(),
+	).
+		Text()
+	if err != nil {
+		return "", q.queueErr(ctx, in.ID, err)
+	}
+	return evicted, nil
+}
+
+// enqueueAndHeadScript adds the member ARGV[1] with score ARGV[2] to the queue
+// in KEYS[1], recording the enqueue time ARGV[3] in KEYS[2], and returns the
+// score of the head of the queue.
+var enqueueAndHeadScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[3])
+return redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')[2]
+`)
+
+// EnqueueAndHeadDelta adds an item to the queue like Enqueue and returns its
+// score minus the score of the head of the queue, i.e. how far behind the
+// front it is. A delta of zero means the item is at the front, or tied with
+// it.
+//
+// The insert and the head read happen atomically in a single Lua script.
+//
+// Returns:
+//   - The score difference between the item and the head of the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueAndHeadDelta(ctx context.Context, in *EnqueueReq) (float64, error) {
+	score, err := q.compositeScore(in)
+	if err != nil {
+		return 0, err
+	}
+
+	head, err := enqueueAndHeadScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, in.ID),
+			fmt.Sprintf(enqueuedAtKey, in.ID),
+		},
+		q.member(in.MemberID),
+		score,
+		time.Now().UnixMilli(),
+	).
+		Float64()
+	if err != nil {
+		return 0, q.queueErr(ctx, in.ID, err)
+	}
+	return score - head, nil
+}
+
+// EnqueueRetry adds an item that already failed attempt times, scoring it
+// baseScore + attempt*penalty so that each failed attempt lowers its priority
+// and fresh items get a chance first. The attempt count is stored alongside
+// until the item leaves the queue and can be read back with AttemptCount.
+//
+// Returns:
+//   - ErrInvalidRequest if attempt is negative.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueRetry(ctx context.Context, queueID, memberID string, baseScore float64, attempt int, penalty float64) error {
+	if attempt < 0 {
+		return fmt.Errorf("%w: negative attempt %d", ErrInvalidRequest, attempt)
+	}
+
+	score := baseScore + float64(attempt)*penalty
+	if err := q.validateScore(score); err != nil {
+		return err
+	}
+
+	member := q.member(memberID)
+	pipe := q.redisClient.Pipeline()
+	pipe.ZAdd(
+		ctx,
+		fmt.Sprintf(queueKey, queueID),
+		redis.Z{
+			Score:  score,
+			Member: member,
+		})
+	pipe.HSet(ctx, fmt.Sprintf(attemptsKey, queueID), member, attempt)
+	pipe.HSetNX(ctx, fmt.Sprintf(enqueuedAtKey, queueID), member, time.Now().UnixMilli())
+	_, err := pipe.Exec(ctx)
+	return q.queueErr(ctx, queueID, err)
+}
+
+// AttemptCount returns the attempt count recorded by EnqueueRetry for the
+// member while it is queued, or 0 if none was recorded. The count is dropped
+// once the member is dequeued, deleted or cleared, so a consumer retrying a
+// member again has to read the count before dequeuing it or carry it along.
+//
+// Returns:
+//   - The attempt count of the member.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) AttemptCount(ctx context.Context, queueID, memberID string) (int, error) {
+	attempt, err := q.reader().
+		HGet(
+			ctx,
+			fmt.Sprintf(attemptsKey, queueID),
+			q.member(memberID),
+		).
+		Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return attempt, err
+}
+
+// enqueueAndNeighborsScript adds the member ARGV[1] with score ARGV[2] to the
+// queue in KEYS[1], recording the enqueue time ARGV[4] in KEYS[2], and returns
+// up to ARGV[3] members right before it and up to ARGV[3] members right after
+// it.
+var enqueueAndNeighborsScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[4])
+local window = tonumber(ARGV[3])
+local before, after = {}, {}
+if window <= 0 then
+	return {before, after}
+end
+local rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+if rank > 0 then
+	local start = rank - window
+	if start < 0 then
+		start = 0
+	end
+	before = redis.call('ZRANGE', KEYS[1], start, rank - 1)
+end
+after = redis.call('ZRANGE', KEYS[1], rank + 1, rank + window)
+return {before, after}
+`)
+
+// EnqueueAndNeighbors adds an item to the queue like Enqueue and returns up to
+// window members right before it and right after it, e.g. to show users who
+// is around them.
+//
+// The insert and the neighbour reads happen atomically in a single Lua script.
+//
+// Returns:
+//   - The members before the item, in dequeue order.
+//   - The members after the item, in dequeue order.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueAndNeighbors(ctx context.Context, in *EnqueueReq, window int) ([]string, []string, error) {
+	score, err := q.compositeScore(in)
+	if err != nil {
+		return []string{}, []string{}, err
+	}
+
+	vals, err := enqueueAndNeighborsScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, in.ID),
+			fmt.Sprintf(enqueuedAtKey, in.ID),
+		},
+		q.member(in.MemberID),
+		score,
+		window,
+		time.Now().UnixMilli(),
+	).
+		Slice()
+	if err != nil {
+		return []string{}, []string{}, q.queueErr(ctx, in.ID, err)
+	}
+	if len(vals) != 2 {
+		return []string{}, []string{}, fmt.Errorf("unexpected neighbors reply length %d", len(vals))
+	}
+	return toStrings(vals[0]), toStrings(vals[1]), nil
+}
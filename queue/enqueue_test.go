@@ -0,0 +1,408 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestAttemptCountClearedOnRemoval(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := q.EnqueueRetry(ctx, "jobs", id, 0, 2, 10); err != nil {
+			t.Fatalf("EnqueueRetry: %v", err)
+		}
+	}
+	attempt, err := q.AttemptCount(ctx, "jobs", "a")
+	if err != nil || attempt != 2 {
+		t.Fatalf("AttemptCount(a) = %d, %v; want 2", attempt, err)
+	}
+
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if attempt, err := q.AttemptCount(ctx, "jobs", "a"); err != nil || attempt != 0 {
+		t.Fatalf("AttemptCount(a) after Dequeue = %d, %v; want 0", attempt, err)
+	}
+	if err := q.Delete(ctx, &queue.DeleteReq{ID: "jobs", MemberID: "b"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := q.Clear(ctx, &queue.ClearReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		attempt, err := q.AttemptCount(ctx, "jobs", id)
+		if err != nil || attempt != 0 {
+			t.Errorf("AttemptCount(%s) = %d, %v; want 0", id, attempt, err)
+		}
+	}
+}
+
+func TestEnqueueIfBelowReportsAdded(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	tests := []struct {
+		member string
+		score  float64
+		want   bool
+	}{
+		{"a", 1, true},
+		{"a", 5, false},
+		{"b", 2, true},
+		{"c", 3, false},
+	}
+	for _, tt := range tests {
+		added, err := q.EnqueueIfBelow(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: tt.member, Score: tt.score}, 2)
+		if err != nil || added != tt.want {
+			t.Errorf("EnqueueIfBelow(%s, %v) = %v, %v; want %v", tt.member, tt.score, added, err, tt.want)
+		}
+	}
+
+	score, err := h.Client.ZScore(ctx, "queue:jobs", "a").Result()
+	if err != nil || score != 5 {
+		t.Fatalf("score of a = %v, %v; want 5", score, err)
+	}
+	if n, err := h.Client.ZCard(ctx, "queue:jobs").Result(); err != nil || n != 2 {
+		t.Fatalf("ZCard = %d, %v; want 2", n, err)
+	}
+}
+
+func TestAttemptCountDroppedOnRemoval(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		remove func(q *queue.Service) error
+	}{
+		{"DedupMembers", func(q *queue.Service) error {
+			_, err := q.DedupMembers(ctx, "jobs", func(string) string { return "same" })
+			return err
+		}},
+		{"ClearWhere", func(q *queue.Service) error {
+			_, err := q.ClearWhere(ctx, "jobs", func(member string, _ float64) bool { return member == "a" })
+			return err
+		}},
+		{"ClearExcept", func(q *queue.Service) error {
+			_, err := q.ClearExcept(ctx, "jobs", []string{"head"})
+			return err
+		}},
+		{"Reconcile", func(q *queue.Service) error {
+			_, _, _, err := q.Reconcile(ctx, "jobs", []queue.EnqueueItem{{MemberID: "head", Score: 0}})
+			return err
+		}},
+		{"EnqueueBounded", func(q *queue.Service) error {
+			_, err := q.EnqueueBounded(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "b", Score: 1}, 2)
+			return err
+		}},
+		{"EnqueueDeadlineBounded", func(q *queue.Service) error {
+			_, err := q.EnqueueDeadlineBounded(ctx, "jobs", "b", time.UnixMilli(1), 2)
+			return err
+		}},
+		{"MoveWhere", func(q *queue.Service) error {
+			_, err := q.MoveWhere(ctx, "jobs", "other", func(member string, _ float64) bool { return member == "a" })
+			return err
+		}},
+		{"Partition", func(q *queue.Service) error {
+			_, err := q.Partition(ctx, "jobs", func(member string, _ float64) string {
+				if member == "a" {
+					return "other"
+				}
+				return ""
+			})
+			return err
+		}},
+		{"SendToDeadLetter", func(q *queue.Service) error {
+			return q.SendToDeadLetter(ctx, "jobs", "a", "poison")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := queuetest.NewTestService(t)
+			if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "head", Score: 0}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			if err := q.EnqueueRetry(ctx, "jobs", "a", 100, 2, 10); err != nil {
+				t.Fatalf("EnqueueRetry: %v", err)
+			}
+
+			if err := tt.remove(q); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if ok, err := q.Contains(ctx, "jobs", "a"); err != nil || ok {
+				t.Fatalf("Contains(a) = %v, %v; want false", ok, err)
+			}
+			if attempt, err := q.AttemptCount(ctx, "jobs", "a"); err != nil || attempt != 0 {
+				t.Fatalf("AttemptCount(a) = %d, %v; want 0", attempt, err)
+			}
+		})
+	}
+}
+
+func TestEnqueueAndTierRankCountsDistinctScores(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for _, req := range []queue.EnqueueReq{
+		{ID: "jobs", MemberID: "a", Score: 1},
+		{ID: "jobs", MemberID: "b", Score: 1},
+		{ID: "jobs", MemberID: "c", Score: 2},
+		{ID: "jobs", MemberID: "d", Score: 2},
+		{ID: "jobs", MemberID: "e", Score: 2},
+	} {
+		if err := q.Enqueue(ctx, &req); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	tests := []struct {
+		member string
+		score  float64
+		want   int64
+	}{
+		{"tied", 2, 1},
+		{"behind", 3, 2},
+		{"head", 0, 0},
+	}
+	for _, tt := range tests {
+		tier, err := q.EnqueueAndTierRank(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: tt.member, Score: tt.score})
+		if err != nil || tier != tt.want {
+			t.Errorf("EnqueueAndTierRank(%s, %v) = %d, %v; want %d", tt.member, tt.score, tier, err, tt.want)
+		}
+	}
+}
+
+func TestEnqueueIfEmpty(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	added, err := q.EnqueueIfEmpty(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "leader", Score: 1})
+	if err != nil || !added {
+		t.Fatalf("EnqueueIfEmpty on an empty queue = %v, %v; want true", added, err)
+	}
+	added, err = q.EnqueueIfEmpty(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "follower", Score: 0})
+	if err != nil || added {
+		t.Fatalf("EnqueueIfEmpty on a non-empty queue = %v, %v; want false", added, err)
+	}
+
+	members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || len(members) != 1 || members[0] != "leader" {
+		t.Fatalf("queue = %v, %v; want [leader]", members, err)
+	}
+}
+
+func TestEnqueueBehindLandsAfterTarget(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := q.EnqueueBehind(ctx, "jobs", "x", "vip"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("EnqueueBehind a missing target: %v; want ErrMemberNotFound", err)
+	}
+	for i, id := range []string{"vip", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	steps := []struct {
+		member, target string
+		want           []string
+	}{
+		{"x", "vip", []string{"vip", "x", "b", "c"}},
+		{"y", "vip", []string{"vip", "y", "x", "b", "c"}},
+		{"z", "c", []string{"vip", "y", "x", "b", "c", "z"}},
+		{"c", "vip", []string{"vip", "c", "y", "x", "b", "z"}},
+	}
+	for _, step := range steps {
+		if err := q.EnqueueBehind(ctx, "jobs", step.member, step.target); err != nil {
+			t.Fatalf("EnqueueBehind(%s, %s): %v", step.member, step.target, err)
+		}
+		members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+		if err != nil || !slices.Equal(members, step.want) {
+			t.Fatalf("queue after EnqueueBehind(%s, %s) = %v, %v; want %v", step.member, step.target, members, err, step.want)
+		}
+	}
+}
+
+func TestFanOutScoresPerQueue(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for _, req := range []queue.EnqueueReq{
+		{ID: "email", MemberID: "other", Score: 2},
+		{ID: "sms", MemberID: "other", Score: 2},
+		{ID: "push", MemberID: "other", Score: 2},
+	} {
+		if err := q.Enqueue(ctx, &req); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	targets := map[string]float64{"email": 1, "sms": 3, "push": 0}
+	if err := q.FanOut(ctx, "event", targets); err != nil {
+		t.Fatalf("FanOut: %v", err)
+	}
+	for queueID, want := range map[string]string{"email": "event", "sms": "other", "push": "event"} {
+		if head, err := q.PeekByQueueID(ctx, queueID); err != nil || head != want {
+			t.Errorf("PeekByQueueID(%s) = %q, %v; want %q", queueID, head, err, want)
+		}
+		score, err := h.Client.ZScore(ctx, "queue:"+queueID, "event").Result()
+		if err != nil || score != targets[queueID] {
+			t.Errorf("score of event in %s = %v, %v; want %v", queueID, score, err, targets[queueID])
+		}
+	}
+}
+
+func TestFanOutNamesFailedQueue(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := h.Client.Set(ctx, "queue:broken", "x", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	err := q.FanOut(ctx, "event", map[string]float64{"ok": 1, "broken": 2})
+	if !errors.Is(err, queue.ErrKeyTypeConflict) || !strings.Contains(err.Error(), "queue broken") {
+		t.Fatalf("FanOut = %v; want ErrKeyTypeConflict naming queue broken", err)
+	}
+	if strings.Contains(err.Error(), "queue ok") {
+		t.Fatalf("FanOut = %v; want only queue broken named", err)
+	}
+	if ok, err := q.Contains(ctx, "ok", "event"); err != nil || !ok {
+		t.Fatalf("Contains(ok, event) = %v, %v; want true", ok, err)
+	}
+}
+
+func TestEnqueueWeightedScore(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	weights := map[string]float64{"age": -1, "size": 0.5, "tier": 100}
+	if err := q.EnqueueWeighted(ctx, "jobs", "a", map[string]float64{"age": 30, "size": 8, "tier": 1}, weights); err != nil {
+		t.Fatalf("EnqueueWeighted: %v", err)
+	}
+	if err := q.EnqueueWeighted(ctx, "jobs", "b", map[string]float64{"tier": 0, "size": 2}, weights); err != nil {
+		t.Fatalf("EnqueueWeighted: %v", err)
+	}
+
+	for member, want := range map[string]float64{"a": 74, "b": 1} {
+		score, err := h.Client.ZScore(ctx, "queue:jobs", member).Result()
+		if err != nil || score != want {
+			t.Errorf("score of %s = %v, %v; want %v", member, score, err, want)
+		}
+	}
+
+	invalid := []map[string]float64{
+		{"priority": 1},
+		{"tier": math.Inf(1)},
+	}
+	for _, factors := range invalid {
+		if err := q.EnqueueWeighted(ctx, "jobs", "c", factors, weights); !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("EnqueueWeighted(%v): %v; want ErrInvalidRequest", factors, err)
+		}
+	}
+}
+
+func TestEnqueueBoundedEvictsLowestPriority(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	steps := []struct {
+		member  string
+		score   float64
+		evicted string
+	}{
+		{"a", 5, ""},
+		{"b", 3, ""},
+		{"c", 1, ""},
+		{"d", 2, "a"},
+		{"e", 9, "e"},
+	}
+	for _, step := range steps {
+		evicted, err := q.EnqueueBounded(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: step.member, Score: step.score}, 3)
+		if err != nil || evicted != step.evicted {
+			t.Fatalf("EnqueueBounded(%s, %v) = %q, %v; want %q", step.member, step.score, evicted, err, step.evicted)
+		}
+	}
+
+	members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || !slices.Equal(members, []string{"c", "d", "b"}) {
+		t.Fatalf("queue = %v, %v; want [c d b]", members, err)
+	}
+	for _, id := range []string{"a", "e"} {
+		if dequeued, err := q.IsDequeued(ctx, "jobs", id); err != nil || dequeued {
+			t.Errorf("IsDequeued(%s) = %v, %v; want false for an evicted item", id, dequeued, err)
+		}
+		if ok, err := h.Client.HExists(ctx, "enqueued_at:jobs", id).Result(); err != nil || ok {
+			t.Errorf("enqueue time of evicted %s kept = %v, %v; want false", id, ok, err)
+		}
+	}
+}
+
+func TestEnqueueAndHeadDelta(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	steps := []struct {
+		member string
+		score  float64
+		want   float64
+	}{
+		{"first", 10, 0},
+		{"behind", 12.5, 2.5},
+		{"front", 4, 0},
+		{"tied", 4, 0},
+		{"back", 20, 16},
+	}
+	for _, step := range steps {
+		delta, err := q.EnqueueAndHeadDelta(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: step.member, Score: step.score})
+		if err != nil || delta != step.want {
+			t.Errorf("EnqueueAndHeadDelta(%s, %v) = %v, %v; want %v", step.member, step.score, delta, err, step.want)
+		}
+	}
+}
+
+func TestEnqueueAndNeighbors(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for i := 0; i < 6; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: string(rune('a' + i)), Score: float64(2 * i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	tests := []struct {
+		member        string
+		score         float64
+		window        int
+		before, after []string
+	}{
+		{"mid", 5, 2, []string{"b", "c"}, []string{"d", "e"}},
+		{"head", -1, 2, []string{}, []string{"a", "b"}},
+		{"tail", 20, 3, []string{"d", "e", "f"}, []string{}},
+		{"none", 7, 0, []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		before, after, err := q.EnqueueAndNeighbors(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: tt.member, Score: tt.score}, tt.window)
+		if err != nil || !slices.Equal(before, tt.before) || !slices.Equal(after, tt.after) {
+			t.Errorf("EnqueueAndNeighbors(%s, %d) = %v, %v, %v; want %v, %v", tt.member, tt.window, before, after, err, tt.before, tt.after)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxExprLength bounds the length of the expressions accepted by EnqueueExpr,
+// which also bounds the recursion depth of their evaluation in Lua.
+const maxExprLength = 256
+
+// invalidExprPrefix prefixes the error replies of enqueueExprScript caused by
+// an invalid expression.
+const invalidExprPrefix = "INVALIDEXPR "
+
+// enqueueExprScript evaluates the expression ARGV[2] with the variables given
+// as ARGV name/value pairs from ARGV[4], then adds the member ARGV[1] to the
+// queue in KEYS[1] with the result as score, recording the enqueue time
+// ARGV[3] in KEYS[2]. It replies with an error starting with INVALIDEXPR if
+// the expression is invalid or its result is not finite.
+var enqueueExprScript = redis.NewScript(scoreLua + `
+local src = ARGV[2]
+local vars = {}
+for i = 4, #ARGV, 2 do
+	vars[ARGV[i]] = tonumber(ARGV[i + 1])
+end
+
+local pos = 1
+local function peek()
+	pos = string.find(src, '[^ \t]', pos) or #src + 1
+	return string.sub(src, pos, pos)
+end
+
+local expr
+local function primary()
+	local c = peek()
+	if c == '(' then
+		pos = pos + 1
+		local v = expr()
+		if peek() ~= ')' then
+			error('expected ) at ' .. pos, 0)
+		end
+		pos = pos + 1
+		return v
+	end
+	if c == '-' then
+		pos = pos + 1
+		return -primary()
+	end
+	local num = string.match(src, '^%d+%.?%d*', pos) or string.match(src, '^%.%d+', pos)
+	if num then
+		pos = pos + #num
+		return tonumber(num)
+	end
+	local name = string.match(src, '^[%a_][%w_]*', pos)
+	if name then
+		pos = pos + #name
+		if vars[name] == nil then
+			error('unknown variable ' .. name, 0)
+		end
+		return vars[name]
+	end
+	if c == '' then
+		error('unexpected end of expression', 0)
+	end
+	error("unexpected '" .. c .. "' at " .. pos, 0)
+end
+
+local function term()
+	local v = primary()
+	while true do
+		local c = peek()
+		if c == '*' then
+			pos = pos + 1
+			v = v * primary()
+		elseif c == '/' then
+			pos = pos + 1
+			v = v / primary()
+		else
+			return v
+		end
+	end
+end
+
+expr = function()
+	local v = term()
+	while true do
+		local c = peek()
+		if c == '+' then
+			pos = pos + 1
+			v = v + term()
+		elseif c == '-' then
+			pos = pos + 1
+			v = v - term()
+		else
+			return v
+		end
+	end
+end
+
+local ok, score = pcall(function()
+	local v = expr()
+	if peek() ~= '' then
+		error("unexpected '" .. peek() .. "' at " .. pos, 0)
+	end
+	return v
+end)
+if not ok then
+	return redis.error_reply('INVALIDEXPR ' .. score)
+end
+if not finite(score) then
+	return redis.error_reply('INVALIDEXPR non-finite score')
+end
+redis.call('ZADD', KEYS[1], score, ARGV[1])
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[3])
+return string.format('%.17g', score)
+`)
+
+// EnqueueExpr adds an item to the queue scored by evaluating expr with vars
+// inside Redis, so the factors do not need to be read back by the client
+// first.
+//
+// The expression grammar is restricted to:
+//   - decimal numbers, such as 2, 0.5 or .5;
+//   - variables, named like Go identifiers and looked up in vars;
+//   - the binary operators +, -, * and /, with the usual precedence and left
+//     associativity;
+//   - unary minus and parentheses.
+//
+// Spaces and tabs are ignored, and expressions are limited to 256 bytes. The
+// score is computed and the item added atomically in a single Lua script.
+// Since the score is only known inside Redis, the WithScoreValidator
+// validator is not applied.
+//
+// Returns:
+//   - ErrInvalidRequest if the expression is invalid, uses an unknown
+//     variable or does not evaluate to a finite score.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueExpr(ctx context.Context, queueID, memberID string, expr string, vars map[string]float64) error {
+	if len(expr) > maxExprLength {
+		return fmt.Errorf("%w: expression longer than %d bytes", ErrInvalidRequest, maxExprLength)
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]interface{}, 0, 3+2*len(vars))
+	args = append(args, q.member(memberID), expr, time.Now().UnixMilli())
+	for _, name := range names {
+		args = append(args, name, formatScore(vars[name]))
+	}
+
+	err := enqueueExprScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		args...,
+	).
+		Err()
+	if err != nil && strings.HasPrefix(err.Error(), invalidExprPrefix) {
+		return fmt.Errorf("%w: %s", ErrInvalidRequest, strings.TrimPrefix(err.Error(), invalidExprPrefix))
+	}
+	return q.queueErr(ctx, queueID, err)
+}
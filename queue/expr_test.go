@@ -0,0 +1,34 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestEnqueueExpr(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	vars := map[string]float64{"age": 3, "weight": 0.5, "zero": 0}
+	if err := q.EnqueueExpr(ctx, "jobs", "a", "(age + 1) * weight - 1", vars); err != nil {
+		t.Fatalf("EnqueueExpr: %v", err)
+	}
+	if score, err := h.Client.ZScore(ctx, "queue:jobs", "a").Result(); err != nil || score != 1 {
+		t.Fatalf("score of a = %v, %v; want 1", score, err)
+	}
+
+	for _, expr := range []string{"1 / zero", "-1 / zero", "zero / zero", "age +", "unknown * 2"} {
+		err := q.EnqueueExpr(ctx, "jobs", "b", expr, vars)
+		if !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("EnqueueExpr(%q): %v; want ErrInvalidRequest", expr, err)
+		}
+	}
+	if ok, err := q.Contains(ctx, "jobs", "b"); err != nil || ok {
+		t.Fatalf("Contains(b) = %v, %v; want false", ok, err)
+	}
+}
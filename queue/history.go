@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+)
+
+// RecentlyDequeued returns the n most recently dequeued members of the queue,
+// most recent first. The Score of each returned Member is its dequeue time in
+// unix milliseconds.
+//
+// Fewer than n members are returned if the dequeue history holds fewer.
+//
+// Returns:
+//   - A slice of Member, most recently dequeued first.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RecentlyDequeued(ctx context.Context, queueID string, n int64) ([]Member, error) {
+	if n <= 0 {
+		return []Member{}, nil
+	}
+
+	history, err := q.reader().
+		ZRevRangeWithScores(
+			ctx,
+			fmt.Sprintf(dequeueHistoryKey, queueID),
+			0,
+			n-1,
+		).
+		Result()
+	if err != nil {
+		return []Member{}, err
+	}
+	return toMembers(history), nil
+}
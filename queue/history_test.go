@@ -0,0 +1,85 @@
+package queue_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestRecentlyDequeuedMostRecentFirst(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	if recent, err := q.RecentlyDequeued(ctx, "jobs", 3); err != nil || len(recent) != 0 {
+		t.Fatalf("RecentlyDequeued before any dequeue = %v, %v; want none", recent, err)
+	}
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		// Dequeue in distinct milliseconds so the history has a strict order.
+		time.Sleep(2 * time.Millisecond)
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+			t.Fatalf("Dequeue: %v", err)
+		}
+	}
+
+	recent, err := q.RecentlyDequeued(ctx, "jobs", 3)
+	if err != nil {
+		t.Fatalf("RecentlyDequeued: %v", err)
+	}
+	var got []string
+	for i, m := range recent {
+		got = append(got, m.MemberID)
+		if i > 0 && m.Score >= recent[i-1].Score {
+			t.Errorf("dequeue time of %s = %v; want before %v", m.MemberID, m.Score, recent[i-1].Score)
+		}
+	}
+	if want := []string{"d", "c", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("RecentlyDequeued(3) = %v; want %v", got, want)
+	}
+
+	if recent, err := q.RecentlyDequeued(ctx, "jobs", 10); err != nil || len(recent) != 4 {
+		t.Fatalf("RecentlyDequeued(10) = %v, %v; want all 4", recent, err)
+	}
+}
+
+func TestWithMaxDequeueHistoryTrimsOldest(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t, queue.WithMaxDequeueHistory(4))
+	q := h.Service
+
+	for i := 0; i < 20; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%02d", i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for i := 0; i < 20; i += 3 {
+		time.Sleep(2 * time.Millisecond)
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 3}); err != nil {
+			t.Fatalf("Dequeue: %v", err)
+		}
+		if size, err := h.Client.ZCard(ctx, "dequeue_history:jobs").Result(); err != nil || size > 4 {
+			t.Fatalf("history size = %d, %v; want at most 4", size, err)
+		}
+	}
+
+	recent, err := q.RecentlyDequeued(ctx, "jobs", 10)
+	if err != nil || len(recent) != 4 {
+		t.Fatalf("RecentlyDequeued = %v, %v; want 4 members", recent, err)
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "m00"); err != nil || dequeued {
+		t.Fatalf("IsDequeued(m00) = %v, %v; want false once trimmed out of the history", dequeued, err)
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "m19"); err != nil || !dequeued {
+		t.Fatalf("IsDequeued(m19) = %v, %v; want true", dequeued, err)
+	}
+}
@@ -0,0 +1,338 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dequeueWithAckScript moves up to ARGV[5] members from the head of the
+// queue to the in-flight set in KEYS[11] with the deadline ARGV[6],
+// remembering their scores in KEYS[12] and issuing each of them a fencing
+// token from the sequence in KEYS[14], stored in KEYS[13]. When ARGV[7] is
+// positive, at most ARGV[7] members can be in flight; nil is returned once
+// the limit is reached. It returns the flat member/score list and the tokens.
+var dequeueWithAckScript = redis.NewScript(dequeueLua + `
+local n = tonumber(ARGV[5])
+local max = tonumber(ARGV[7])
+if max > 0 then
+	local free = max - redis.call('ZCARD', KEYS[11])
+	if free <= 0 then
+		return false
+	end
+	if free < n then
+		n = free
+	end
+end
+local popped = take(n, '-inf')
+local tokens = {}
+for i = 1, #popped, 2 do
+	local token = redis.call('INCR', KEYS[14])
+	redis.call('ZADD', KEYS[11], ARGV[6], popped[i])
+	redis.call('HSET', KEYS[12], popped[i], popped[i + 1])
+	redis.call('HSET', KEYS[13], popped[i], token)
+	table.insert(tokens, token)
+end
+return {popped, tokens}
+`)
+
+// ackScript removes the member ARGV[1] from the in-flight set in KEYS[1] and
+// returns the score remembered for it in KEYS[2], or nil if it is not in
+// flight. When ARGV[2] is not empty, it must match the fencing token of the
+// member in KEYS[3], otherwise nothing is removed and 0 is returned. The
+// redelivery count of an acknowledged member in KEYS[4] is dropped.
+var ackScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return false
+end
+if ARGV[2] ~= '' and redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+local score = redis.call('HGET', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[4], ARGV[1])
+return score
+`)
+
+// requeueExpiredScript moves every member of the in-flight set in KEYS[2]
+// whose deadline is before ARGV[1] back to the queue in KEYS[1] at its
+// remembered score in KEYS[3], revoking its fencing token in KEYS[4] and
+// recording ARGV[1] as its enqueue time in KEYS[5].
+var requeueExpiredScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1])
+for _, member in ipairs(expired) do
+	local score = redis.call('HGET', KEYS[3], member) or 0
+	redis.call('ZADD', KEYS[1], score, member)
+	redis.call('HSETNX', KEYS[5], member, ARGV[1])
+	redis.call('ZREM', KEYS[2], member)
+	redis.call('HDEL', KEYS[3], member)
+	redis.call('HDEL', KEYS[4], member)
+end
+return #expired
+`)
+
+// DequeueWithAck removes up to n items from the head of the queue and keeps
+// them in flight until they are acknowledged with Ack.
+//
+// Items that are not acknowledged before the visibility timeout are put back
+// in the queue by RequeueExpired. When the Service is created with
+// WithMaxInFlight, fewer than n items are returned if the limit would be
+// exceeded, and ErrInFlightLimit is returned if no slot is free. The check and
+// the move happen atomically in a single Lua script.
+//
+// Returns:
+//   - A slice of strings containing the dequeued item IDs.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DequeueWithAck(ctx context.Context, queueID string, n int, visibility time.Duration) ([]string, error) {
+	popped, _, err := q.dequeueWithAck(ctx, queueID, n, visibility)
+	if err != nil {
+		return []string{}, err
+	}
+	return memberIDs(popped), nil
+}
+
+// FencedMember represents an item dequeued with DequeueWithTokens together
+// with the fencing token issued for this delivery.
+type FencedMember struct {
+	// MemberID is the unique identifier of the item.
+	MemberID string
+
+	// Token identifies this delivery of the item. Tokens are issued from a
+	// per-queue sequence, so a later delivery always has a greater token.
+	Token int64
+}
+
+// DequeueWithTokens behaves like DequeueWithAck, but also returns the fencing
+// token issued for every item. Passing the token to AckWithToken guarantees
+// that a worker whose item expired and was redelivered to another worker
+// cannot acknowledge it anymore. The tokens can also serve as correlation IDs
+// for tracing.
+//
+// Returns:
+//   - A slice of FencedMember in dequeue order.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DequeueWithTokens(ctx context.Context, queueID string, n int, visibility time.Duration) ([]FencedMember, error) {
+	popped, tokens, err := q.dequeueWithAck(ctx, queueID, n, visibility)
+	if err != nil {
+		return []FencedMember{}, err
+	}
+
+	members := make([]FencedMember, 0, len(popped))
+	for i, z := range popped {
+		members = append(members, FencedMember{
+			MemberID: z.Member.(string),
+			Token:    tokens[i],
+		})
+	}
+	return members, nil
+}
+
+// dequeueWithAck runs dequeueWithAckScript and returns the items moved in
+// flight along with their fencing tokens.
+func (q *Service) dequeueWithAck(ctx context.Context, queueID string, n int, visibility time.Duration) ([]redis.Z, []int64, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	vals, err := dequeueWithAckScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(
+			queueID,
+			fmt.Sprintf(inFlightKey, queueID),
+			fmt.Sprintf(inFlightScoreKey, queueID),
+			fmt.Sprintf(inFlightTokenKey, queueID),
+			fmt.Sprintf(fencingSeqKey, queueID),
+		),
+		q.dequeueArgs(true, n, time.Now().Add(visibility).UnixMilli(), q.maxInFlight)...,
+	).
+		Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, ErrInFlightLimit
+	}
+	if err != nil {
+		return nil, nil, q.queueErr(ctx, queueID, err)
+	}
+	if len(vals) != 2 {
+		return nil, nil, fmt.Errorf("unexpected dequeue reply length %d", len(vals))
+	}
+
+	flat, _ := vals[0].([]interface{})
+	popped, err := parseScored(flat)
+	if err != nil {
+		return nil, nil, q.queueErr(ctx, queueID, err)
+	}
+	rawTokens, _ := vals[1].([]interface{})
+	tokens := make([]int64, 0, len(rawTokens))
+	for _, raw := range rawTokens {
+		token, ok := raw.(int64)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected token type %T", raw)
+		}
+		tokens = append(tokens, token)
+	}
+	if len(tokens) != len(popped) {
+		return nil, nil, fmt.Errorf("got %d tokens for %d members", len(tokens), len(popped))
+	}
+	return popped, tokens, nil
+}
+
+// Ack acknowledges an item dequeued with DequeueWithAck, removing it from the
+// in-flight set and recording it as dequeued. Fencing tokens are not checked,
+// so a worker whose item expired and was redelivered can still acknowledge the
+// new delivery.
+//
+// Deprecated: Use DequeueWithTokens and AckWithToken, which reject
+// acknowledgements of stale deliveries.
+//
+// Returns:
+//   - ErrMemberNotFound if the item is not in flight.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Ack(ctx context.Context, queueID, memberID string) error {
+	return q.ack(ctx, queueID, memberID, "")
+}
+
+// AckWithToken acknowledges an item dequeued with DequeueWithTokens like Ack,
+// provided token is the fencing token of its current delivery.
+//
+// Returns:
+//   - ErrMemberNotFound if the item is not in flight.
+//   - ErrStaleToken if the item was redelivered since token was issued.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) AckWithToken(ctx context.Context, queueID, memberID string, token int64) error {
+	return q.ack(ctx, queueID, memberID, strconv.FormatInt(token, 10))
+}
+
+// ack runs ackScript, checking the fencing token unless it is empty, and
+// records the acknowledged item as dequeued.
+func (q *Service) ack(ctx context.Context, queueID, memberID, token string) error {
+	member := q.member(memberID)
+	reply, err := ackScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(inFlightKey, queueID),
+			fmt.Sprintf(inFlightScoreKey, queueID),
+			fmt.Sprintf(inFlightTokenKey, queueID),
+			fmt.Sprintf(redeliveriesKey, queueID),
+		},
+		member,
+		token,
+	).
+		Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+
+	raw, ok := reply.(string)
+	if !ok {
+		return ErrStaleToken
+	}
+	score, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	return q.recordCompleted(ctx, queueID, []redis.Z{{Score: score, Member: member}})
+}
+
+// RequeueExpired puts every in-flight item whose visibility timeout has
+// elapsed back in the queue at the score it had when it was dequeued.
+//
+// Returns:
+//   - The number of requeued items.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RequeueExpired(ctx context.Context, queueID string) (int64, error) {
+	requeued, err := requeueExpiredScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(inFlightKey, queueID),
+			fmt.Sprintf(inFlightScoreKey, queueID),
+			fmt.Sprintf(inFlightTokenKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		time.Now().UnixMilli(),
+	).
+		Int64()
+	return requeued, q.queueErr(ctx, queueID, err)
+}
+
+// recoverExpiredToDLQScript handles every member of the in-flight set in
+// KEYS[2] whose deadline is before ARGV[1]: it increments its redelivery count
+// in KEYS[4], then moves it back to the queue in KEYS[1] at its remembered
+// score in KEYS[3] while the count is below ARGV[2], or to the dead-letter
+// queue in KEYS[5] once it reaches it; an ARGV[2] <= 0 never dead-letters. Fencing tokens in KEYS[6] are revoked
+// and requeued members get ARGV[1] as their enqueue time in KEYS[7].
+// It returns the requeued and the dead-lettered members.
+var recoverExpiredToDLQScript = redis.NewScript(`
+local maxRedeliveries = tonumber(ARGV[2])
+local requeued, deadLettered = {}, {}
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1])
+for _, member in ipairs(expired) do
+	local score = redis.call('HGET', KEYS[3], member) or 0
+	redis.call('ZREM', KEYS[2], member)
+	redis.call('HDEL', KEYS[3], member)
+	redis.call('HDEL', KEYS[6], member)
+	local count = redis.call('HINCRBY', KEYS[4], member, 1)
+	if maxRedeliveries > 0 and count >= maxRedeliveries then
+		redis.call('HDEL', KEYS[4], member)
+		redis.call('ZADD', KEYS[5], ARGV[1], member)
+		table.insert(deadLettered, member)
+	else
+		redis.call('ZADD', KEYS[1], score, member)
+		redis.call('HSETNX', KEYS[7], member, ARGV[1])
+		table.insert(requeued, member)
+	end
+end
+return {requeued, deadLettered}
+`)
+
+// RecoverExpiredToDLQ handles every in-flight item whose visibility timeout
+// has elapsed: its redelivery count is incremented, then it is put back in the
+// queue at its original score while the count is below maxRedeliveries, or
+// moved to the dead-letter queue once the count reaches it. A maxRedeliveries
+// <= 0 sets no limit: expired items are always requeued. The count of an item
+// is dropped once it is acknowledged or dead-lettered.
+//
+// All items are handled atomically in a single Lua script.
+//
+// Returns:
+//   - The requeued members.
+//   - The dead-lettered members.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RecoverExpiredToDLQ(ctx context.Context, queueID string, maxRedeliveries int) ([]string, []string, error) {
+	vals, err := recoverExpiredToDLQScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(inFlightKey, queueID),
+			fmt.Sprintf(inFlightScoreKey, queueID),
+			fmt.Sprintf(redeliveriesKey, queueID),
+			fmt.Sprintf(deadLetterKey, queueID),
+			fmt.Sprintf(inFlightTokenKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		time.Now().UnixMilli(),
+		maxRedeliveries,
+	).
+		Slice()
+	if err != nil {
+		return []string{}, []string{}, q.queueErr(ctx, queueID, err)
+	}
+	if len(vals) != 2 {
+		return []string{}, []string{}, fmt.Errorf("unexpected recover reply length %d", len(vals))
+	}
+
+	return toStrings(vals[0]), toStrings(vals[1]), nil
+}
@@ -0,0 +1,144 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+// expire dequeues member with a short visibility timeout and lets it expire.
+func expire(t *testing.T, q *queue.Service, member string) {
+	t.Helper()
+	got, err := q.DequeueWithAck(context.Background(), "jobs", 1, 10*time.Millisecond)
+	if err != nil || !slices.Equal(got, []string{member}) {
+		t.Fatalf("DequeueWithAck = %v, %v; want [%s]", got, err, member)
+	}
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestRecoverExpiredToDLQ(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	expire(t, q, "a")
+	requeued, deadLettered, err := q.RecoverExpiredToDLQ(ctx, "jobs", 2)
+	if err != nil || !slices.Equal(requeued, []string{"a"}) || len(deadLettered) != 0 {
+		t.Fatalf("RecoverExpiredToDLQ = %v, %v, %v; want [a], []", requeued, deadLettered, err)
+	}
+
+	expire(t, q, "a")
+	requeued, deadLettered, err = q.RecoverExpiredToDLQ(ctx, "jobs", 2)
+	if err != nil || len(requeued) != 0 || !slices.Equal(deadLettered, []string{"a"}) {
+		t.Fatalf("RecoverExpiredToDLQ = %v, %v, %v; want [], [a]", requeued, deadLettered, err)
+	}
+	if n, err := h.Client.HLen(ctx, "redeliveries:jobs").Result(); err != nil || n != 0 {
+		t.Fatalf("redelivery counts = %d, %v; want none", n, err)
+	}
+}
+
+func TestRecoverExpiredToDLQWithoutLimit(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		expire(t, q, "a")
+		requeued, deadLettered, err := q.RecoverExpiredToDLQ(ctx, "jobs", 0)
+		if err != nil || !slices.Equal(requeued, []string{"a"}) || len(deadLettered) != 0 {
+			t.Fatalf("RecoverExpiredToDLQ #%d = %v, %v, %v; want [a], []", i, requeued, deadLettered, err)
+		}
+	}
+}
+
+func TestAckDropsRedeliveryCount(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	expire(t, q, "a")
+	if _, _, err := q.RecoverExpiredToDLQ(ctx, "jobs", 3); err != nil {
+		t.Fatalf("RecoverExpiredToDLQ: %v", err)
+	}
+
+	got, err := q.DequeueWithTokens(ctx, "jobs", 1, time.Minute)
+	if err != nil || len(got) != 1 {
+		t.Fatalf("DequeueWithTokens = %v, %v; want one member", got, err)
+	}
+	if err := q.AckWithToken(ctx, "jobs", "a", got[0].Token); err != nil {
+		t.Fatalf("AckWithToken: %v", err)
+	}
+	if n, err := h.Client.HLen(ctx, "redeliveries:jobs").Result(); err != nil || n != 0 {
+		t.Fatalf("redelivery counts = %d, %v; want none", n, err)
+	}
+}
+
+func TestAckWithTokenRejectsStaleDelivery(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	first, err := q.DequeueWithTokens(ctx, "jobs", 1, 10*time.Millisecond)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("DequeueWithTokens = %v, %v; want one member", first, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := q.RequeueExpired(ctx, "jobs"); err != nil {
+		t.Fatalf("RequeueExpired: %v", err)
+	}
+	second, err := q.DequeueWithTokens(ctx, "jobs", 1, time.Minute)
+	if err != nil || len(second) != 1 {
+		t.Fatalf("DequeueWithTokens = %v, %v; want one member", second, err)
+	}
+
+	if err := q.AckWithToken(ctx, "jobs", "a", first[0].Token); !errors.Is(err, queue.ErrStaleToken) {
+		t.Fatalf("AckWithToken with the stale token = %v; want ErrStaleToken", err)
+	}
+	if err := q.AckWithToken(ctx, "jobs", "a", second[0].Token); err != nil {
+		t.Fatalf("AckWithToken: %v", err)
+	}
+}
+
+func TestMaxInFlightRefusesUntilAck(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t, queue.WithMaxInFlight(2)).Service
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	// Only the free slots are filled.
+	got, err := q.DequeueWithAck(ctx, "jobs", 3, time.Minute)
+	if err != nil || !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("DequeueWithAck = %v, %v; want [a b]", got, err)
+	}
+	if _, err := q.DequeueWithAck(ctx, "jobs", 1, time.Minute); !errors.Is(err, queue.ErrInFlightLimit) {
+		t.Fatalf("DequeueWithAck at the limit: %v; want ErrInFlightLimit", err)
+	}
+
+	if err := q.Ack(ctx, "jobs", "a"); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	got, err = q.DequeueWithAck(ctx, "jobs", 2, time.Minute)
+	if err != nil || !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("DequeueWithAck after Ack = %v, %v; want [c]", got, err)
+	}
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Violation describes an inconsistency detected by CheckInvariants.
+type Violation struct {
+	// MemberID is the member involved in the violation, if any.
+	MemberID string
+
+	// Message is a human readable description of the violation.
+	Message string
+}
+
+// CheckInvariants inspects the Redis state of a queue and reports every
+// detected inconsistency:
+//   - a member present in both the queue and the dequeue set;
+//   - a member with a non-finite score;
+//   - a clear flag set while the queue still holds members.
+//
+// It is read-only and meant for tests and canaries; it loads the whole queue
+// and dequeue set in memory.
+//
+// Returns:
+//   - The detected violations, empty when the queue is consistent.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) CheckInvariants(ctx context.Context, queueID string) ([]Violation, error) {
+	pipe := q.reader().Pipeline()
+	queued := pipe.ZRangeWithScores(ctx, fmt.Sprintf(queueKey, queueID), 0, -1)
+	dequeued := pipe.SMembers(ctx, fmt.Sprintf(dequeueKey, queueID))
+	cleared := pipe.Exists(ctx, fmt.Sprintf(clearKey, queueID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, q.queueErr(ctx, queueID, err)
+	}
+
+	isDequeued := make(map[string]struct{}, len(dequeued.Val()))
+	for _, m := range dequeued.Val() {
+		isDequeued[m] = struct{}{}
+	}
+
+	violations := []Violation{}
+	for _, z := range queued.Val() {
+		member := z.Member.(string)
+		if _, ok := isDequeued[member]; ok {
+			violations = append(violations, Violation{
+				MemberID: member,
+				Message:  fmt.Sprintf("member %s in both queue and dequeue set", member),
+			})
+		}
+		if math.IsInf(z.Score, 0) || math.IsNaN(z.Score) {
+			violations = append(violations, Violation{
+				MemberID: member,
+				Message:  fmt.Sprintf("member %s has non-finite score %v", member, z.Score),
+			})
+		}
+	}
+	if cleared.Val() == 1 && len(queued.Val()) > 0 {
+		violations = append(violations, Violation{
+			Message: fmt.Sprintf("clear flag set while queue holds %d members", len(queued.Val())),
+		})
+	}
+
+	return violations, nil
+}
+
+// Inversion describes a member served ahead of a member with a better logical
+// priority, as reported by DetectInversions.
+type Inversion struct {
+	// Ahead is the member with the worse logical priority that sits ahead.
+	Ahead string
+
+	// AheadRank is the position of Ahead in the queue.
+	AheadRank int64
+
+	// Behind is the member with the better logical priority that sits behind.
+	Behind string
+
+	// BehindRank is the position of Behind in the queue.
+	BehindRank int64
+}
+
+// DetectInversions walks the queue in dequeue order and reports every member
+// sitting behind a member with a worse logical priority, as defined by
+// priorityOf (lower values mean higher priority, like scores).
+//
+// Each member behind is reported once, against the worst member ahead of it.
+// The queue is read in pages, so the result may be inaccurate if the queue is
+// modified during the walk.
+//
+// Returns:
+//   - The detected inversions, empty when the order is consistent.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DetectInversions(ctx context.Context, queueID string, priorityOf func(member string) int) ([]Inversion, error) {
+	const pageSize = 100
+
+	inversions := []Inversion{}
+	var (
+		worst     string
+		worstPrio int
+		worstRank int64
+		rank      int64
+	)
+	for {
+		members, err := q.reader().
+			ZRange(
+				ctx,
+				fmt.Sprintf(queueKey, queueID),
+				rank,
+				rank+pageSize-1,
+			).
+			Result()
+		if err != nil {
+			return nil, q.queueErr(ctx, queueID, err)
+		}
+
+		for _, member := range members {
+			prio := priorityOf(member)
+			switch {
+			case rank == 0 || prio > worstPrio:
+				worst, worstPrio, worstRank = member, prio, rank
+			case prio < worstPrio:
+				inversions = append(inversions, Inversion{
+					Ahead:      worst,
+					AheadRank:  worstRank,
+					Behind:     member,
+					BehindRank: rank,
+				})
+			}
+			rank++
+		}
+
+		if len(members) < pageSize {
+			return inversions, nil
+		}
+	}
+}
+
+// FindOutOfBounds returns the members whose score is below lo or above hi,
+// helping to spot suspicious scores. Both ranges are read in a single
+// pipeline. lo is expected not to exceed hi, otherwise members in between are
+// reported twice.
+//
+// Returns:
+//   - The members below lo followed by the members above hi, in dequeue order.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) FindOutOfBounds(ctx context.Context, queueID string, lo, hi float64) ([]Member, error) {
+	key := fmt.Sprintf(queueKey, queueID)
+
+	pipe := q.reader().Pipeline()
+	below := pipe.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + formatScore(lo),
+	})
+	above := pipe.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min: "(" + formatScore(hi),
+		Max: "+inf",
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return []Member{}, q.queueErr(ctx, queueID, err)
+	}
+
+	return toMembers(append(below.Val(), above.Val()...)), nil
+}
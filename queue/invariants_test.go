@@ -0,0 +1,115 @@
+package queue_test
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCheckInvariants(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for _, id := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if violations, err := q.CheckInvariants(ctx, "jobs"); err != nil || len(violations) != 0 {
+		t.Fatalf("CheckInvariants on a consistent queue = %v, %v; want none", violations, err)
+	}
+
+	if err := h.Client.SAdd(ctx, "dequeue:jobs", "a").Err(); err != nil {
+		t.Fatalf("SAdd: %v", err)
+	}
+	if err := h.Client.ZAdd(ctx, "queue:jobs", redis.Z{Score: math.Inf(1), Member: "b"}).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+	if err := h.Client.Set(ctx, "clear:jobs", "{}", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	violations, err := q.CheckInvariants(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("CheckInvariants: %v", err)
+	}
+	want := []queue.Violation{
+		{MemberID: "a", Message: "member a in both queue and dequeue set"},
+		{MemberID: "b", Message: "member b has non-finite score +Inf"},
+		{Message: "clear flag set while queue holds 2 members"},
+	}
+	if len(violations) != len(want) {
+		t.Fatalf("CheckInvariants = %v; want %v", violations, want)
+	}
+	for i := range want {
+		if violations[i] != want[i] {
+			t.Errorf("violations[%d] = %+v; want %+v", i, violations[i], want[i])
+		}
+	}
+}
+
+func TestDetectInversionsFindsSeededInversion(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	priority := map[string]int{"a": 1, "b": 3, "c": 2, "d": 3, "e": 1}
+	priorityOf := func(member string) int { return priority[member] }
+
+	inversions, err := q.DetectInversions(ctx, "jobs", priorityOf)
+	if err != nil || len(inversions) != 0 {
+		t.Fatalf("DetectInversions on an empty queue = %v, %v; want none", inversions, err)
+	}
+
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	inversions, err = q.DetectInversions(ctx, "jobs", priorityOf)
+	if err != nil {
+		t.Fatalf("DetectInversions: %v", err)
+	}
+	want := []queue.Inversion{
+		{Ahead: "b", AheadRank: 1, Behind: "c", BehindRank: 2},
+		{Ahead: "b", AheadRank: 1, Behind: "e", BehindRank: 4},
+	}
+	if !slices.Equal(inversions, want) {
+		t.Fatalf("DetectInversions = %+v; want %+v", inversions, want)
+	}
+
+	inversions, err = q.DetectInversions(ctx, "jobs", func(string) int { return 0 })
+	if err != nil || len(inversions) != 0 {
+		t.Fatalf("DetectInversions with equal priorities = %v, %v; want none", inversions, err)
+	}
+}
+
+func TestFindOutOfBounds(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for i, score := range []float64{-1, 0, 5, 10, 11, math.Inf(1)} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: string(rune('a' + i)), Score: score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	got, err := q.FindOutOfBounds(ctx, "jobs", 0, 10)
+	want := []queue.Member{{MemberID: "a", Score: -1}, {MemberID: "e", Score: 11}, {MemberID: "f", Score: math.Inf(1)}}
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("FindOutOfBounds(0, 10) = %v, %v; want %v", got, err, want)
+	}
+
+	// Bounds are inclusive.
+	got, err = q.FindOutOfBounds(ctx, "jobs", -1, 11)
+	want = []queue.Member{{MemberID: "f", Score: math.Inf(1)}}
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("FindOutOfBounds(-1, 11) = %v, %v; want %v", got, err, want)
+	}
+}
@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// leaseClockLua is prepended to the lease scripts. It defines serverNow(),
+// which returns the time of the Redis server in unix milliseconds, so that
+// lease expiries do not depend on the clocks of the workers.
+const leaseClockLua = `
+local function serverNow()
+	local t = redis.call('TIME')
+	return tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+`
+
+// leaseScript pops the head of the queue and stores it in the lease hash
+// KEYS[11] under the token ARGV[5] as "expiry|score|member", the lease
+// expiring ARGV[6] milliseconds from now. It returns the member and its
+// score, or nil if the queue is empty.
+var leaseScript = redis.NewScript(dequeueLua + leaseClockLua + `
+local popped = take(1, '-inf')
+if #popped == 0 then
+	return false
+end
+local expiry = serverNow() + tonumber(ARGV[6])
+redis.call('HSET', KEYS[11], ARGV[5], expiry .. '|' .. popped[2] .. '|' .. popped[1])
+return popped
+`)
+
+// renewLeaseScript makes the lease ARGV[1] in KEYS[1] expire ARGV[2]
+// milliseconds from now if it has not expired yet. It returns 0 if the lease
+// is missing or expired.
+var renewLeaseScript = redis.NewScript(leaseClockLua + `
+local lease = redis.call('HGET', KEYS[1], ARGV[1])
+if not lease then
+	return 0
+end
+local now = serverNow()
+local expiry, rest = string.match(lease, '^([^|]*)|(.*)$')
+if tonumber(expiry) < now then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], (now + tonumber(ARGV[2])) .. '|' .. rest)
+return 1
+`)
+
+// completeLeaseScript removes the lease ARGV[1] from KEYS[1] and returns its
+// stored value, or nil if it is missing.
+var completeLeaseScript = redis.NewScript(`
+local lease = redis.call('HGET', KEYS[1], ARGV[1])
+if not lease then
+	return false
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+return lease
+`)
+
+// recoverLeasesScript puts every lease of KEYS[2] that has expired back in the
+// queue in KEYS[1] at its stored score, recording ARGV[1] as its enqueue time
+// in KEYS[3]. It returns the number of recovered leases.
+var recoverLeasesScript = redis.NewScript(leaseClockLua + `
+local leases = redis.call('HGETALL', KEYS[2])
+local now = serverNow()
+local recovered = 0
+for i = 1, #leases, 2 do
+	local expiry, score, member = string.match(leases[i + 1], '^([^|]*)|([^|]*)|(.*)$')
+	if tonumber(expiry) < now then
+		redis.call('ZADD', KEYS[1], score, member)
+		redis.call('HSETNX', KEYS[3], member, ARGV[1])
+		redis.call('HDEL', KEYS[2], leases[i])
+		recovered = recovered + 1
+	end
+end
+return recovered
+`)
+
+// Lease removes the head of the queue and leases it for ttl under a random
+// lease token. The lease must be completed with CompleteLease, and can be
+// extended with RenewLease; once expired, RecoverLeases puts the item back in
+// the queue at its original score.
+//
+// Lease expiries are measured with the clock of the Redis server, so workers
+// with skewed clocks agree on them.
+//
+// Returns:
+//   - The leased member and the lease token.
+//   - ErrQueueEmpty if the queue is empty.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Lease(ctx context.Context, queueID string, ttl time.Duration) (string, string, error) {
+	token, err := newLeaseToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	popped, err := leaseScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(queueID, fmt.Sprintf(leasedKey, queueID)),
+		q.dequeueArgs(true, token, ttl.Milliseconds())...,
+	).
+		StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return "", "", ErrQueueEmpty
+	}
+	if err != nil {
+		return "", "", q.queueErr(ctx, queueID, err)
+	}
+	return popped[0], token, nil
+}
+
+// RenewLease extends an unexpired lease so it expires ttl from now.
+//
+// Returns:
+//   - ErrLeaseNotFound if the lease does not exist or has expired.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RenewLease(ctx context.Context, queueID, lease string, ttl time.Duration) error {
+	renewed, err := renewLeaseScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(leasedKey, queueID)},
+		lease,
+		ttl.Milliseconds(),
+	).
+		Int()
+	if err != nil {
+		return err
+	}
+	if renewed == 0 {
+		return ErrLeaseNotFound
+	}
+	return nil
+}
+
+// CompleteLease releases a lease and records its item as dequeued. A lease
+// that expired but was not recovered yet can still be completed.
+//
+// Returns:
+//   - ErrLeaseNotFound if the lease does not exist.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) CompleteLease(ctx context.Context, queueID, lease string) error {
+	raw, err := completeLeaseScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(leasedKey, queueID)},
+		lease,
+	).
+		Text()
+	if errors.Is(err, redis.Nil) {
+		return ErrLeaseNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	parts := strings.SplitN(raw, "|", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed lease %q", raw)
+	}
+	score, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return fmt.Errorf("malformed lease %q: %w", raw, err)
+	}
+	return q.recordCompleted(ctx, queueID, []redis.Z{{Score: score, Member: parts[2]}})
+}
+
+// RecoverLeases puts the item of every expired lease back in the queue at the
+// score it had when it was leased. All leases are checked atomically in a
+// single Lua script.
+//
+// Returns:
+//   - The number of recovered leases.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RecoverLeases(ctx context.Context, queueID string) (int64, error) {
+	recovered, err := recoverLeasesScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(leasedKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		time.Now().UnixMilli(),
+	).
+		Int64()
+	return recovered, q.queueErr(ctx, queueID, err)
+}
+
+// newLeaseToken returns a random hex encoded lease token.
+func newLeaseToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
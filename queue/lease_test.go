@@ -0,0 +1,75 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestLeaseCompleteRenewAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i + 1)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	lease := func(want string, ttl time.Duration) string {
+		t.Helper()
+		member, token, err := q.Lease(ctx, "jobs", ttl)
+		if err != nil || member != want {
+			t.Fatalf("Lease = %q, %v; want %q", member, err, want)
+		}
+		return token
+	}
+	renewed := lease("a", time.Minute)
+	completed := lease("b", time.Minute)
+
+	if err := q.RenewLease(ctx, "jobs", renewed, 5*time.Minute); err != nil {
+		t.Fatalf("RenewLease: %v", err)
+	}
+	if err := q.CompleteLease(ctx, "jobs", completed); err != nil {
+		t.Fatalf("CompleteLease: %v", err)
+	}
+	if err := q.CompleteLease(ctx, "jobs", completed); !errors.Is(err, queue.ErrLeaseNotFound) {
+		t.Fatalf("CompleteLease twice: %v; want ErrLeaseNotFound", err)
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "b"); err != nil || !dequeued {
+		t.Fatalf("IsDequeued(b) = %v, %v; want true", dequeued, err)
+	}
+
+	// The renewed lease outlives its original TTL.
+	h.FastForward(2 * time.Minute)
+	if recovered, err := q.RecoverLeases(ctx, "jobs"); err != nil || recovered != 0 {
+		t.Fatalf("RecoverLeases = %d, %v; want 0", recovered, err)
+	}
+
+	lease("c", time.Minute)
+	h.FastForward(4 * time.Minute)
+	if err := q.RenewLease(ctx, "jobs", renewed, time.Minute); !errors.Is(err, queue.ErrLeaseNotFound) {
+		t.Fatalf("RenewLease after expiry: %v; want ErrLeaseNotFound", err)
+	}
+	if recovered, err := q.RecoverLeases(ctx, "jobs"); err != nil || recovered != 2 {
+		t.Fatalf("RecoverLeases = %d, %v; want 2", recovered, err)
+	}
+
+	members, err := h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRangeWithScores: %v", err)
+	}
+	got := []string{}
+	for _, z := range members {
+		got = append(got, z.Member.(string))
+	}
+	if want := []string{"a", "c"}; !slices.Equal(got, want) || members[0].Score != 1 || members[1].Score != 3 {
+		t.Fatalf("queue = %v; want %v at their original scores", members, want)
+	}
+}
@@ -0,0 +1,46 @@
+package queue_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDequeueSkipLocked(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	locked, err := q.LockMember(ctx, "jobs", "a", time.Minute)
+	if err != nil || !locked {
+		t.Fatalf("LockMember = %v, %v; want true", locked, err)
+	}
+
+	got, err := q.DequeueSkipLocked(ctx, "jobs", 2)
+	if err != nil {
+		t.Fatalf("DequeueSkipLocked: %v", err)
+	}
+	if want := []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("DequeueSkipLocked = %v; want %v", got, want)
+	}
+	dequeued, err := q.IsDequeued(ctx, "jobs", "b")
+	if err != nil || !dequeued {
+		t.Fatalf("IsDequeued(b) = %v, %v; want true", dequeued, err)
+	}
+
+	if err := q.UnlockMember(ctx, "jobs", "a"); err != nil {
+		t.Fatalf("UnlockMember: %v", err)
+	}
+	got, err = q.DequeueSkipLocked(ctx, "jobs", 2)
+	if err != nil || !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("DequeueSkipLocked after unlock = %v, %v; want [a]", got, err)
+	}
+}
@@ -0,0 +1,290 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DedupMembers groups the members of the queue by keyOf(member) and, for every
+// group, keeps only the member with the best (lowest) score, removing the
+// others. Among members sharing the best score, the lexically smallest one is
+// kept.
+//
+// The queue is read once and the duplicates are removed in a single ZREM, so
+// members enqueued in between are not deduplicated.
+//
+// Returns:
+//   - The number of removed members.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DedupMembers(ctx context.Context, queueID string, keyOf func(memberID string) string) (int64, error) {
+	members, err := q.redisClient.
+		ZRange(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			0,
+			-1,
+		).
+		Result()
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+
+	// Members are sorted by score, so the first member of each group is the
+	// one to keep.
+	kept := make(map[string]struct{}, len(members))
+	duplicates := []string{}
+	for _, member := range members {
+		key := keyOf(member)
+		if _, ok := kept[key]; ok {
+			duplicates = append(duplicates, member)
+			continue
+		}
+		kept[key] = struct{}{}
+	}
+	if len(duplicates) == 0 {
+		return 0, nil
+	}
+
+	pipe := q.redisClient.TxPipeline()
+	args := make([]interface{}, len(duplicates))
+	for i, member := range duplicates {
+		args[i] = member
+	}
+	removed := pipe.ZRem(ctx, fmt.Sprintf(queueKey, queueID), args...)
+	pipe.HDel(ctx, fmt.Sprintf(enqueuedAtKey, queueID), duplicates...)
+	pipe.HDel(ctx, fmt.Sprintf(attemptsKey, queueID), duplicates...)
+	pipe.HDel(ctx, fmt.Sprintf(updateCountKey, queueID), duplicates...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	return removed.Val(), nil
+}
+
+// reconcileDequeuedScript removes from the dequeue set in KEYS[2], its
+// history in KEYS[3] and recorded scores in KEYS[4] every member that is
+// currently in the queue in KEYS[1]. It returns the number of removed members.
+var reconcileDequeuedScript = redis.NewScript(`
+local reconciled = 0
+for _, member in ipairs(redis.call('SMEMBERS', KEYS[2])) do
+	if redis.call('ZSCORE', KEYS[1], member) then
+		redis.call('SREM', KEYS[2], member)
+		redis.call('ZREM', KEYS[3], member)
+		redis.call('HDEL', KEYS[4], member)
+		reconciled = reconciled + 1
+	end
+end
+return reconciled
+`)
+
+// ReconcileDequeued removes from the dequeue tracking every member that is
+// back in the queue, since a queued member is not really done. Such stale
+// entries appear when members are re-enqueued after being dequeued.
+//
+// The check and removal happen atomically in a single Lua script that walks
+// the whole dequeue set.
+//
+// Returns:
+//   - The number of reconciled members.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ReconcileDequeued(ctx context.Context, queueID string) (int64, error) {
+	reconciled, err := reconcileDequeuedScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(dequeueKey, queueID),
+			fmt.Sprintf(dequeueHistoryKey, queueID),
+			fmt.Sprintf(dequeuedScoreKey, queueID),
+		},
+	).
+		Int64()
+	return reconciled, q.queueErr(ctx, queueID, err)
+}
+
+// ClearWhere removes from the queue every member for which pred returns true.
+// Removed members are not marked as dequeued.
+//
+// The queue is read in pages and pred is evaluated in Go, then the matching
+// members are removed in a single pipeline. Members enqueued or rescored during
+// the scan may be missed, and members dequeued in between are not counted.
+//
+// Returns:
+//   - The number of removed members.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ClearWhere(ctx context.Context, queueID string, pred func(member string, score float64) bool) (int64, error) {
+	const pageSize = 100
+
+	matches := []interface{}{}
+	for rank := int64(0); ; rank += pageSize {
+		members, err := q.redisClient.
+			ZRangeWithScores(
+				ctx,
+				fmt.Sprintf(queueKey, queueID),
+				rank,
+				rank+pageSize-1,
+			).
+			Result()
+		if err != nil {
+			return 0, q.queueErr(ctx, queueID, err)
+		}
+
+		for _, member := range members {
+			if pred(member.Member.(string), member.Score) {
+				matches = append(matches, member.Member)
+			}
+		}
+
+		if len(members) < pageSize {
+			break
+		}
+	}
+	if len(matches) == 0 {
+		return 0, nil
+	}
+
+	pipe := q.redisClient.Pipeline()
+	removed := pipe.ZRem(ctx, fmt.Sprintf(queueKey, queueID), matches...)
+	pipe.HDel(ctx, fmt.Sprintf(enqueuedAtKey, queueID), toStrings(matches)...)
+	pipe.HDel(ctx, fmt.Sprintf(attemptsKey, queueID), toStrings(matches)...)
+	pipe.HDel(ctx, fmt.Sprintf(updateCountKey, queueID), toStrings(matches)...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	return removed.Val(), nil
+}
+
+// reconcileScript makes the queue in KEYS[1] hold exactly the members and
+// scores given as ARGV member/score pairs from ARGV[2], only touching the
+// members that differ. Added members get the enqueue time ARGV[1] in KEYS[2],
+// removed members lose theirs, their update count in KEYS[3] and their attempt
+// count in KEYS[4], and the update count of rescored members is incremented.
+// It returns the number of added, removed and rescored members.
+var reconcileScript = redis.NewScript(`
+local desired = {}
+for i = 2, #ARGV, 2 do
+	desired[ARGV[i]] = ARGV[i + 1]
+end
+local added, removed, updated = 0, 0, 0
+local current = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+for i = 1, #current, 2 do
+	local member = current[i]
+	local score = desired[member]
+	if not score then
+		redis.call('ZREM', KEYS[1], member)
+		redis.call('HDEL', KEYS[2], member)
+		redis.call('HDEL', KEYS[3], member)
+		redis.call('HDEL', KEYS[4], member)
+		removed = removed + 1
+	else
+		if tonumber(score) ~= tonumber(current[i + 1]) then
+			redis.call('ZADD', KEYS[1], score, member)
+			redis.call('HINCRBY', KEYS[3], member, 1)
+			updated = updated + 1
+		end
+		desired[member] = nil
+	end
+end
+for member, score in pairs(desired) do
+	redis.call('ZADD', KEYS[1], score, member)
+	redis.call('HSET', KEYS[2], member, ARGV[1])
+	added = added + 1
+end
+return {added, removed, updated}
+`)
+
+// Reconcile makes the queue hold exactly the desired items: missing items are
+// added, items not desired are removed and items with a different score are
+// rescored. If an item is listed several times, its last score wins.
+//
+// The queue is diffed and updated atomically in a single Lua script, so
+// reconciling the same desired items repeatedly is idempotent. Removed items
+// are not recorded as dequeued.
+//
+// Returns:
+//   - The number of added, removed and rescored items.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Reconcile(ctx context.Context, queueID string, desired []EnqueueItem) (int64, int64, int64, error) {
+	args := make([]interface{}, 0, 1+2*len(desired))
+	args = append(args, time.Now().UnixMilli())
+	for _, item := range desired {
+		if err := q.validateScore(item.Score); err != nil {
+			return 0, 0, 0, err
+		}
+		args = append(args, q.member(item.MemberID), formatScore(item.Score))
+	}
+
+	counts, err := reconcileScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+			fmt.Sprintf(attemptsKey, queueID),
+		},
+		args...,
+	).
+		Int64Slice()
+	if err != nil {
+		return 0, 0, 0, q.queueErr(ctx, queueID, err)
+	}
+	if len(counts) != 3 {
+		return 0, 0, 0, fmt.Errorf("unexpected reconcile reply length %d", len(counts))
+	}
+	return counts[0], counts[1], counts[2], nil
+}
+
+// clearExceptScript removes every member of the queue in KEYS[1], with its
+// enqueue time in KEYS[2], attempt count in KEYS[3] and update count in
+// KEYS[4], except the members given as ARGV. It returns the number of removed
+// members.
+var clearExceptScript = redis.NewScript(`
+local protected = {}
+for _, member in ipairs(ARGV) do
+	protected[member] = true
+end
+local removed = 0
+for _, member in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	if not protected[member] then
+		redis.call('ZREM', KEYS[1], member)
+		redis.call('HDEL', KEYS[2], member)
+		redis.call('HDEL', KEYS[3], member)
+		redis.call('HDEL', KEYS[4], member)
+		removed = removed + 1
+	end
+end
+return removed
+`)
+
+// ClearExcept removes every member of the queue except the protected ones,
+// which keep their scores. Unlike Clear, it does not set the clear flag, and
+// removed members are not marked as dequeued.
+//
+// The removal happens atomically in a single Lua script.
+//
+// Returns:
+//   - The number of removed members.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ClearExcept(ctx context.Context, queueID string, protectedMembers []string) (int64, error) {
+	args := make([]interface{}, 0, len(protectedMembers))
+	for _, memberID := range protectedMembers {
+		args = append(args, q.member(memberID))
+	}
+
+	removed, err := clearExceptScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+			fmt.Sprintf(attemptsKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		args...,
+	).
+		Int64()
+	return removed, q.queueErr(ctx, queueID, err)
+}
@@ -0,0 +1,200 @@
+package queue_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDedupMembersKeepsBestScore(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for _, req := range []queue.EnqueueReq{
+		{ID: "jobs", MemberID: "user-1", Score: 5},
+		{ID: "jobs", MemberID: "USER-1", Score: 2},
+		{ID: "jobs", MemberID: " user-1 ", Score: 9},
+		{ID: "jobs", MemberID: "user-2", Score: 3},
+		{ID: "jobs", MemberID: "User-2", Score: 3},
+		{ID: "jobs", MemberID: "user-3", Score: 1},
+	} {
+		if err := q.Enqueue(ctx, &req); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	normalize := func(member string) string { return strings.ToLower(strings.TrimSpace(member)) }
+	removed, err := q.DedupMembers(ctx, "jobs", normalize)
+	if err != nil || removed != 3 {
+		t.Fatalf("DedupMembers = %d, %v; want 3", removed, err)
+	}
+
+	got, err := h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRangeWithScores: %v", err)
+	}
+	want := []redis.Z{{Score: 1, Member: "user-3"}, {Score: 2, Member: "USER-1"}, {Score: 3, Member: "User-2"}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("queue = %v; want %v", got, want)
+	}
+
+	if removed, err := q.DedupMembers(ctx, "jobs", normalize); err != nil || removed != 0 {
+		t.Fatalf("second DedupMembers = %d, %v; want 0", removed, err)
+	}
+}
+
+func TestReconcileDequeuedDropsRequeuedMembers(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 3}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	for _, id := range []string{"a", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	reconciled, err := q.ReconcileDequeued(ctx, "jobs")
+	if err != nil || reconciled != 2 {
+		t.Fatalf("ReconcileDequeued = %d, %v; want 2", reconciled, err)
+	}
+	for id, want := range map[string]bool{"a": false, "b": true, "c": false} {
+		if dequeued, err := q.IsDequeued(ctx, "jobs", id); err != nil || dequeued != want {
+			t.Errorf("IsDequeued(%s) = %v, %v; want %v", id, dequeued, err, want)
+		}
+	}
+	history, err := h.Client.ZRange(ctx, "dequeue_history:jobs", 0, -1).Result()
+	if err != nil || !slices.Equal(history, []string{"b"}) {
+		t.Fatalf("dequeue history = %v, %v; want [b]", history, err)
+	}
+
+	if reconciled, err := q.ReconcileDequeued(ctx, "jobs"); err != nil || reconciled != 0 {
+		t.Fatalf("second ReconcileDequeued = %d, %v; want 0", reconciled, err)
+	}
+}
+
+func TestClearWhereAcrossPages(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	const members = 250
+	for i := 0; i < members; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%03d", i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	removed, err := q.ClearWhere(ctx, "jobs", func(_ string, score float64) bool { return int(score)%2 == 1 })
+	if err != nil || removed != members/2 {
+		t.Fatalf("ClearWhere = %d, %v; want %d", removed, err, members/2)
+	}
+	remaining, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || len(remaining) != members/2 {
+		t.Fatalf("queue holds %d members, %v; want %d", len(remaining), err, members/2)
+	}
+	for i, id := range remaining {
+		if want := fmt.Sprintf("m%03d", 2*i); id != want {
+			t.Fatalf("remaining member %d = %s; want %s", i, id, want)
+		}
+	}
+	if ok, err := h.Client.HExists(ctx, "enqueued_at:jobs", "m001").Result(); err != nil || ok {
+		t.Fatalf("enqueue time of a removed member kept = %v, %v; want false", ok, err)
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "m001"); err != nil || dequeued {
+		t.Fatalf("IsDequeued(m001) = %v, %v; want false", dequeued, err)
+	}
+
+	if removed, err := q.ClearWhere(ctx, "jobs", func(string, float64) bool { return false }); err != nil || removed != 0 {
+		t.Fatalf("ClearWhere with no match = %d, %v; want 0", removed, err)
+	}
+}
+
+func TestReconcileToDesiredSet(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"keep", "rescore", "drop"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	desired := []queue.EnqueueItem{
+		{MemberID: "keep", Score: 0},
+		{MemberID: "rescore", Score: 7},
+		{MemberID: "new", Score: 3},
+		{MemberID: "new", Score: 5},
+	}
+	added, removed, rescored, err := q.Reconcile(ctx, "jobs", desired)
+	if err != nil || added != 1 || removed != 1 || rescored != 1 {
+		t.Fatalf("Reconcile = %d, %d, %d, %v; want 1, 1, 1", added, removed, rescored, err)
+	}
+
+	got, err := h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRangeWithScores: %v", err)
+	}
+	want := []redis.Z{{Score: 0, Member: "keep"}, {Score: 5, Member: "new"}, {Score: 7, Member: "rescore"}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("queue = %v; want %v", got, want)
+	}
+	if ok, err := h.Client.HExists(ctx, "enqueued_at:jobs", "drop").Result(); err != nil || ok {
+		t.Fatalf("enqueue time of the removed member kept = %v, %v; want false", ok, err)
+	}
+	if ok, err := h.Client.HExists(ctx, "enqueued_at:jobs", "new").Result(); err != nil || !ok {
+		t.Fatalf("enqueue time of the added member recorded = %v, %v; want true", ok, err)
+	}
+
+	added, removed, rescored, err = q.Reconcile(ctx, "jobs", desired)
+	if err != nil || added != 0 || removed != 0 || rescored != 0 {
+		t.Fatalf("second Reconcile = %d, %d, %d, %v; want no change", added, removed, rescored, err)
+	}
+}
+
+func TestClearExceptKeepsProtectedMembers(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	removed, err := q.ClearExcept(ctx, "jobs", []string{"b", "d", "missing"})
+	if err != nil || removed != 2 {
+		t.Fatalf("ClearExcept = %d, %v; want 2", removed, err)
+	}
+	got, err := h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if want := []redis.Z{{Score: 1, Member: "b"}, {Score: 3, Member: "d"}}; err != nil || !slices.Equal(got, want) {
+		t.Fatalf("queue = %v, %v; want %v", got, err, want)
+	}
+	if ok, err := h.Client.HExists(ctx, "enqueued_at:jobs", "a").Result(); err != nil || ok {
+		t.Fatalf("enqueue time of a removed member kept = %v, %v; want false", ok, err)
+	}
+	if _, cleared, err := q.ClearInfo(ctx, "jobs"); err != nil || cleared {
+		t.Fatalf("ClearInfo after ClearExcept: cleared = %v, %v; want false", cleared, err)
+	}
+
+	if removed, err := q.ClearExcept(ctx, "jobs", nil); err != nil || removed != 2 {
+		t.Fatalf("ClearExcept with nothing protected = %d, %v; want 2", removed, err)
+	}
+}
@@ -0,0 +1,334 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// moveMemberScript moves the member ARGV[1] from the queue in KEYS[1] to the
+// queue in KEYS[2], keeping its current score, and moves its enqueue time from
+// KEYS[3] to KEYS[4], ARGV[2] being used when none is recorded. Its attempt
+// and update counts in the source queue, in KEYS[5] and KEYS[6], are dropped. It returns 0 when the
+// member is no longer in the source queue.
+var moveMemberScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+	return 0
+end
+local enqueuedAt = redis.call('HGET', KEYS[3], ARGV[1]) or ARGV[2]
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[5], ARGV[1])
+redis.call('HDEL', KEYS[6], ARGV[1])
+redis.call('ZADD', KEYS[2], score, ARGV[1])
+redis.call('HSETNX', KEYS[4], ARGV[1], enqueuedAt)
+return 1
+`)
+
+// MoveWhere moves every member of the source queue matching pred to the
+// destination queue, preserving its score and enqueue time. Attempt and
+// update counts are not carried over.
+//
+// The source queue is read once and pred is evaluated in Go, then the matching
+// members are moved in a single pipeline. Each move is atomic and re-reads the
+// member's score, so members removed or re-scored in between are skipped or
+// moved with their latest score.
+//
+// Returns:
+//   - The number of members moved.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) MoveWhere(ctx context.Context, fromQueueID, toQueueID string, pred func(member string, score float64) bool) (int64, error) {
+	fromKey := fmt.Sprintf(queueKey, fromQueueID)
+	toKey := fmt.Sprintf(queueKey, toQueueID)
+
+	members, err := q.redisClient.
+		ZRangeWithScores(
+			ctx,
+			fromKey,
+			0,
+			-1,
+		).
+		Result()
+	if err != nil {
+		return 0, q.queueErr(ctx, fromQueueID, err)
+	}
+
+	keys := []string{
+		fromKey,
+		toKey,
+		fmt.Sprintf(enqueuedAtKey, fromQueueID),
+		fmt.Sprintf(enqueuedAtKey, toQueueID),
+		fmt.Sprintf(attemptsKey, fromQueueID),
+		fmt.Sprintf(updateCountKey, fromQueueID),
+	}
+	now := time.Now().UnixMilli()
+	pipe := q.redisClient.Pipeline()
+	cmds := make([]*redis.Cmd, 0, len(members))
+	for _, z := range members {
+		if !pred(z.Member.(string), z.Score) {
+			continue
+		}
+		cmds = append(cmds, moveMemberScript.Eval(ctx, pipe, keys, z.Member, now))
+	}
+	if len(cmds) == 0 {
+		return 0, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, q.queueErr(ctx, fromQueueID, err)
+	}
+
+	var moved int64
+	for _, cmd := range cmds {
+		n, err := cmd.Int64()
+		if err != nil {
+			return moved, q.queueErr(ctx, fromQueueID, err)
+		}
+		moved += n
+	}
+	return moved, nil
+}
+
+// cycleScript moves the head of the queue in KEYS[1] to the back, scoring it
+// one past the current tail score. It returns the moved member, or nil if the
+// queue is empty.
+var cycleScript = redis.NewScript(`
+local head = redis.call('ZRANGE', KEYS[1], 0, 0)
+if #head == 0 then
+	return false
+end
+local tail = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+redis.call('ZADD', KEYS[1], tonumber(tail[2]) + 1, head[1])
+return head[1]
+`)
+
+// Cycle moves the head of the queue to the back of the line and returns it,
+// for round-robin processing where an item is re-examined after all others.
+//
+// The member is re-scored one past the current tail score atomically in a
+// single Lua script, so it is never lost.
+//
+// Returns:
+//   - The cycled member.
+//   - ErrQueueEmpty if the queue is empty.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Cycle(ctx context.Context, queueID string) (string, error) {
+	member, err := cycleScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(queueKey, queueID)},
+	).
+		Text()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrQueueEmpty
+	}
+	if err != nil {
+		return "", q.queueErr(ctx, queueID, err)
+	}
+	return member, nil
+}
+
+// Partition distributes the members of the source queue across destination
+// queues chosen by dest, preserving their scores and enqueue times, and
+// removes them from the source queue. Attempt and update counts are not
+// carried over.
+// Members for which dest returns an empty string or the source queue ID stay
+// in place.
+//
+// The source queue is read once, then all moves are applied in a single
+// MULTI/EXEC transaction. Only the members read are removed from the source,
+// so members enqueued in between are kept.
+//
+// Returns:
+//   - The number of members moved into each destination queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Partition(ctx context.Context, sourceQueueID string, dest func(member string, score float64) string) (map[string]int64, error) {
+	sourceKey := fmt.Sprintf(queueKey, sourceQueueID)
+	sourceEnqueuedAtKey := fmt.Sprintf(enqueuedAtKey, sourceQueueID)
+
+	pipe := q.redisClient.Pipeline()
+	read := pipe.ZRangeWithScores(ctx, sourceKey, 0, -1)
+	times := pipe.HGetAll(ctx, sourceEnqueuedAtKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, q.queueErr(ctx, sourceQueueID, err)
+	}
+	members := read.Val()
+	enqueuedAt := times.Val()
+
+	groups := make(map[string][]redis.Z)
+	moved := []redis.Z{}
+	for _, z := range members {
+		queueID := dest(z.Member.(string), z.Score)
+		if queueID == "" || queueID == sourceQueueID {
+			continue
+		}
+		groups[queueID] = append(groups[queueID], z)
+		moved = append(moved, z)
+	}
+
+	counts := make(map[string]int64, len(groups))
+	if len(moved) == 0 {
+		return counts, nil
+	}
+
+	now := time.Now().UnixMilli()
+	_, err := q.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for queueID, zs := range groups {
+			pipe.ZAdd(ctx, fmt.Sprintf(queueKey, queueID), zs...)
+			for _, z := range zs {
+				member := z.Member.(string)
+				if at, ok := enqueuedAt[member]; ok {
+					pipe.HSetNX(ctx, fmt.Sprintf(enqueuedAtKey, queueID), member, at)
+				} else {
+					pipe.HSetNX(ctx, fmt.Sprintf(enqueuedAtKey, queueID), member, now)
+				}
+			}
+		}
+		pipe.ZRem(ctx, sourceKey, memberArgs(moved)...)
+		pipe.HDel(ctx, sourceEnqueuedAtKey, memberIDs(moved)...)
+		pipe.HDel(ctx, fmt.Sprintf(attemptsKey, sourceQueueID), memberIDs(moved)...)
+		pipe.HDel(ctx, fmt.Sprintf(updateCountKey, sourceQueueID), memberIDs(moved)...)
+		return nil
+	})
+	if err != nil {
+		return nil, q.queueErr(ctx, sourceQueueID, err)
+	}
+
+	for queueID, zs := range groups {
+		counts[queueID] = int64(len(zs))
+	}
+	return counts, nil
+}
+
+// pipeScript pops up to ARGV[5] members from the head of the queue, records
+// them as dequeued and adds them to the queue in KEYS[11] with their score
+// shifted by ARGV[6], recording the enqueue time in KEYS[12]. It returns the
+// moved members with their original scores.
+var pipeScript = redis.NewScript(dequeueLua + scoreLua + `
+local delta = tonumber(ARGV[6])
+local popped = take(tonumber(ARGV[5]), '-inf')
+for i = 1, #popped, 2 do
+	redis.call('ZADD', KEYS[11], toscore(popped[i + 1]) + delta, popped[i])
+	redis.call('HSETNX', KEYS[12], popped[i], now)
+end
+record(popped)
+return popped
+`)
+
+// Pipe atomically moves up to n items from the head of one queue into another
+// queue, for multi-stage processing pipelines. Each item is added to the
+// destination with its score shifted by delta; use a delta of 0 to keep the
+// scores; items with an infinite score keep it. Moved items are recorded as
+// enqueued now in the destination.
+//
+// The pop, the push and the recording of the moved items as dequeued from the
+// source queue happen in a single Lua script.
+//
+// Returns:
+//   - A slice of strings containing the moved item IDs.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Pipe(ctx context.Context, fromQueueID, toQueueID string, n int, delta float64) ([]string, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	vals, err := pipeScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(
+			fromQueueID,
+			fmt.Sprintf(queueKey, toQueueID),
+			fmt.Sprintf(enqueuedAtKey, toQueueID),
+		),
+		q.dequeueArgs(true, n, delta)...,
+	).
+		Slice()
+	if err != nil {
+		return []string{}, q.queuesErr(ctx, err, fromQueueID, toQueueID)
+	}
+
+	popped, err := parseScored(vals)
+	if err != nil {
+		return []string{}, err
+	}
+	return memberIDs(popped), nil
+}
+
+// placeAheadScript scores the member ARGV[1] of the queue in KEYS[1] at the
+// midpoint between the target member ARGV[2] and its predecessor, or one
+// below the target score when the target is the head, incrementing its update
+// count in KEYS[2]. It returns 0 if either member is not in the queue.
+var placeAheadScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+local target = redis.call('ZSCORE', KEYS[1], ARGV[2])
+if not target then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+local rank = redis.call('ZRANK', KEYS[1], ARGV[2])
+local score
+if rank > 0 then
+	local predecessor = redis.call('ZRANGE', KEYS[1], rank - 1, rank - 1, 'WITHSCORES')
+	score = (tonumber(predecessor[2]) + tonumber(target)) / 2
+else
+	score = tonumber(target) - 1
+end
+redis.call('ZADD', KEYS[1], score, ARGV[1])
+redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+return 1
+`)
+
+// MoveAhead moves a queued member immediately ahead of the target member,
+// scoring it at the midpoint between the target and the member right before
+// it, or one below the target score when the target is the head.
+//
+// The scores are read and the member moved atomically in a single Lua script.
+// Like EnqueueBehind, repeated moves between the same pair of neighbours
+// eventually exhaust the float64 precision and fall back to lexical order.
+//
+// Returns:
+//   - ErrMemberNotFound if the member or the target is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) MoveAhead(ctx context.Context, queueID, memberID, targetMemberID string) error {
+	if memberID == targetMemberID {
+		return ErrInvalidRequest
+	}
+
+	placed, err := placeAheadScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		q.member(memberID),
+		q.member(targetMemberID),
+	).
+		Int()
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	if placed == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// MoveBehind moves a queued member immediately behind the target member,
+// scoring it at the midpoint between the target and the member right after
+// it, or one past the target score when the target is the tail.
+//
+// This is EnqueueBehind restricted to members already in the queue, and has
+// the same precision limits.
+//
+// Returns:
+//   - ErrMemberNotFound if the member or the target is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) MoveBehind(ctx context.Context, queueID, memberID, targetMemberID string) error {
+	return q.placeBehind(ctx, queueID, memberID, targetMemberID, true)
+}
@@ -0,0 +1,269 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPipeKeepsInfiniteScores(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+
+	if err := h.Client.ZAdd(ctx, "queue:src",
+		redis.Z{Score: math.Inf(-1), Member: "first"},
+		redis.Z{Score: 1, Member: "a"},
+		redis.Z{Score: math.Inf(1), Member: "last"},
+	).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	moved, err := h.Service.Pipe(ctx, "src", "dst", 3, 10)
+	if err != nil || len(moved) != 3 {
+		t.Fatalf("Pipe = %v, %v; want 3 members", moved, err)
+	}
+
+	want := map[string]float64{"first": math.Inf(-1), "a": 11, "last": math.Inf(1)}
+	for member, score := range want {
+		got, err := h.Client.ZScore(ctx, "queue:dst", member).Result()
+		if err != nil || got != score {
+			t.Errorf("score of %s = %v, %v; want %v", member, got, err, score)
+		}
+	}
+}
+
+func TestPipeMovesHeadInOrder(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "src", MemberID: id, Score: float64(i + 1)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	moved, err := q.Pipe(ctx, "src", "dst", 3, 10)
+	if err != nil || !slices.Equal(moved, []string{"a", "b", "c"}) {
+		t.Fatalf("Pipe = %v, %v; want [a b c]", moved, err)
+	}
+
+	dst, err := h.Client.ZRangeWithScores(ctx, "queue:dst", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRangeWithScores: %v", err)
+	}
+	want := []redis.Z{{Score: 11, Member: "a"}, {Score: 12, Member: "b"}, {Score: 13, Member: "c"}}
+	if !slices.Equal(dst, want) {
+		t.Fatalf("destination = %v; want %v", dst, want)
+	}
+	for _, id := range moved {
+		if ok, err := h.Client.HExists(ctx, "enqueued_at:dst", id).Result(); err != nil || !ok {
+			t.Errorf("enqueue time of %s in the destination recorded = %v, %v; want true", id, ok, err)
+		}
+		if dequeued, err := q.IsDequeued(ctx, "src", id); err != nil || !dequeued {
+			t.Errorf("IsDequeued(src, %s) = %v, %v; want true", id, dequeued, err)
+		}
+	}
+
+	for _, want := range [][]string{{"d"}, {}} {
+		moved, err := q.Pipe(ctx, "src", "dst", 3, 0)
+		if err != nil || !slices.Equal(moved, want) {
+			t.Fatalf("Pipe = %v, %v; want %v", moved, err, want)
+		}
+	}
+	if n, err := h.Client.ZCard(ctx, "queue:dst").Result(); err != nil || n != 4 {
+		t.Fatalf("destination length = %d, %v; want 4", n, err)
+	}
+}
+
+func TestMoveWhereAboveThreshold(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "src", MemberID: id, Score: float64(i + 1)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	moved, err := q.MoveWhere(ctx, "src", "dst", func(_ string, score float64) bool { return score > 3 })
+	if err != nil || moved != 2 {
+		t.Fatalf("MoveWhere = %d, %v; want 2", moved, err)
+	}
+
+	src, err := h.Client.ZRange(ctx, "queue:src", 0, -1).Result()
+	if err != nil || !slices.Equal(src, []string{"a", "b", "c"}) {
+		t.Fatalf("source = %v, %v; want [a b c]", src, err)
+	}
+	dst, err := h.Client.ZRangeWithScores(ctx, "queue:dst", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRangeWithScores: %v", err)
+	}
+	want := []redis.Z{{Score: 4, Member: "d"}, {Score: 5, Member: "e"}}
+	if !slices.Equal(dst, want) {
+		t.Fatalf("destination = %v; want %v", dst, want)
+	}
+
+	moved, err = q.MoveWhere(ctx, "src", "dst", func(string, float64) bool { return false })
+	if err != nil || moved != 0 {
+		t.Fatalf("MoveWhere with no match = %d, %v; want 0", moved, err)
+	}
+}
+
+func TestCycleRotatesHeadToBack(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if _, err := q.Cycle(ctx, "jobs"); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("Cycle on an empty queue: %v; want ErrQueueEmpty", err)
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for _, want := range [][]string{{"b", "c", "a"}, {"c", "a", "b"}, {"a", "b", "c"}} {
+		if _, err := q.Cycle(ctx, "jobs"); err != nil {
+			t.Fatalf("Cycle: %v", err)
+		}
+		members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+		if err != nil || !slices.Equal(members, want) {
+			t.Fatalf("queue after Cycle = %v, %v; want %v", members, err, want)
+		}
+	}
+	if cycled, err := q.Cycle(ctx, "jobs"); err != nil || cycled != "a" {
+		t.Fatalf("Cycle = %q, %v; want a", cycled, err)
+	}
+}
+
+func TestPartitionByEvenOddMember(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i := 0; i < 7; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "src", MemberID: strconv.Itoa(i), Score: float64(10 + i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	counts, err := q.Partition(ctx, "src", func(member string, _ float64) string {
+		n, _ := strconv.Atoi(member)
+		switch {
+		case n == 6:
+			return ""
+		case n%2 == 0:
+			return "even"
+		default:
+			return "odd"
+		}
+	})
+	if err != nil {
+		t.Fatalf("Partition: %v", err)
+	}
+	if len(counts) != 2 || counts["even"] != 3 || counts["odd"] != 3 {
+		t.Fatalf("Partition = %v; want map[even:3 odd:3]", counts)
+	}
+
+	want := map[string][]redis.Z{
+		"even": {{Score: 10, Member: "0"}, {Score: 12, Member: "2"}, {Score: 14, Member: "4"}},
+		"odd":  {{Score: 11, Member: "1"}, {Score: 13, Member: "3"}, {Score: 15, Member: "5"}},
+		"src":  {{Score: 16, Member: "6"}},
+	}
+	for queueID, members := range want {
+		got, err := h.Client.ZRangeWithScores(ctx, fmt.Sprintf("queue:%s", queueID), 0, -1).Result()
+		if err != nil || !slices.Equal(got, members) {
+			t.Errorf("queue %s = %v, %v; want %v", queueID, got, err, members)
+		}
+	}
+}
+
+func TestMoveAheadOfTarget(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	steps := []struct {
+		member, target string
+		want           []string
+	}{
+		{"d", "b", []string{"a", "d", "b", "c"}},
+		{"c", "a", []string{"c", "a", "d", "b"}},
+		{"a", "b", []string{"c", "d", "a", "b"}},
+	}
+	for _, step := range steps {
+		if err := q.MoveAhead(ctx, "jobs", step.member, step.target); err != nil {
+			t.Fatalf("MoveAhead(%s, %s): %v", step.member, step.target, err)
+		}
+		members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+		if err != nil || !slices.Equal(members, step.want) {
+			t.Fatalf("queue after MoveAhead(%s, %s) = %v, %v; want %v", step.member, step.target, members, err, step.want)
+		}
+	}
+
+	for _, pair := range [][2]string{{"missing", "a"}, {"a", "missing"}} {
+		if err := q.MoveAhead(ctx, "jobs", pair[0], pair[1]); !errors.Is(err, queue.ErrMemberNotFound) {
+			t.Errorf("MoveAhead(%s, %s): %v; want ErrMemberNotFound", pair[0], pair[1], err)
+		}
+	}
+	if err := q.MoveAhead(ctx, "jobs", "a", "a"); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Fatalf("MoveAhead of a member ahead of itself: %v; want ErrInvalidRequest", err)
+	}
+}
+
+func TestMoveBehindTarget(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	steps := []struct {
+		member, target string
+		want           []string
+	}{
+		{"a", "c", []string{"b", "c", "a", "d"}},
+		{"b", "d", []string{"c", "a", "d", "b"}},
+		{"d", "c", []string{"c", "d", "a", "b"}},
+	}
+	for _, step := range steps {
+		if err := q.MoveBehind(ctx, "jobs", step.member, step.target); err != nil {
+			t.Fatalf("MoveBehind(%s, %s): %v", step.member, step.target, err)
+		}
+		members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+		if err != nil || !slices.Equal(members, step.want) {
+			t.Fatalf("queue after MoveBehind(%s, %s) = %v, %v; want %v", step.member, step.target, members, err, step.want)
+		}
+	}
+
+	// Unlike EnqueueBehind, MoveBehind never adds a member.
+	for _, pair := range [][2]string{{"missing", "a"}, {"a", "missing"}} {
+		if err := q.MoveBehind(ctx, "jobs", pair[0], pair[1]); !errors.Is(err, queue.ErrMemberNotFound) {
+			t.Errorf("MoveBehind(%s, %s): %v; want ErrMemberNotFound", pair[0], pair[1], err)
+		}
+	}
+	if ok, err := q.Contains(ctx, "jobs", "missing"); err != nil || ok {
+		t.Fatalf("Contains(missing) = %v, %v; want false", ok, err)
+	}
+}
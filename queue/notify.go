@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// OnEmpty returns a channel receiving a value every time the queue goes from
+// non-empty to empty. The channel is closed when ctx is cancelled.
+//
+// Redis deletes a sorted set when its last member is removed, so transitions
+// are detected through keyspace notifications of the queue key deletion. The
+// Redis server must have keyspace notifications enabled for generic commands,
+// e.g. notify-keyspace-events "Kg" (or "KA"); otherwise the channel never
+// fires. A signal is dropped if the previous one has not been received yet.
+// With Redis Cluster, notifications are only published by the node holding
+// the queue, which the subscription may not be connected to.
+//
+// Returns:
+//   - A channel signalling empty transitions.
+//   - An error if the subscription fails; otherwise, nil.
+func (q *Service) OnEmpty(ctx context.Context, queueID string) (<-chan struct{}, error) {
+	channel := fmt.Sprintf(
+		"__keyspace@%d__:%s",
+		clientDB(q.redisClient),
+		fmt.Sprintf(queueKey, queueID),
+	)
+
+	pubsub := q.redisClient.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	signals := make(chan struct{}, 1)
+	go func() {
+		defer close(signals)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if msg.Payload != "del" {
+					continue
+				}
+				select {
+				case signals <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return signals, nil
+}
+
+// clientDB returns the database number the client is connected to.
+func clientDB(client redis.UniversalClient) int {
+	switch c := client.(type) {
+	case *redis.Client:
+		return c.Options().DB
+	case *redis.Ring:
+		return c.Options().DB
+	default:
+		return 0
+	}
+}
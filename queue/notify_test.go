@@ -0,0 +1,69 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestOnEmptySignalsEmptyTransition(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	h.SkipUnlessKeyspaceNotifications(t)
+	q := h.Service
+
+	if err := h.Client.ConfigSet(ctx, "notify-keyspace-events", "Kg").Err(); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	signals, err := q.OnEmpty(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("OnEmpty: %v", err)
+	}
+
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	select {
+	case <-signals:
+		t.Fatal("signalled while the queue is not empty")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	select {
+	case <-signals:
+	case <-time.After(time.Second):
+		t.Fatal("no signal once the queue became empty")
+	}
+}
+
+func TestOnEmptyClosesOnCancel(t *testing.T) {
+	q, _ := queuetest.NewTestService(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals, err := q.OnEmpty(ctx, "jobs")
+	if err != nil {
+		t.Fatalf("OnEmpty: %v", err)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-signals:
+		if ok {
+			t.Fatal("received a signal; want the channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after ctx was cancelled")
+	}
+}
@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Option configures optional behaviour of a Service.
+type Option func(*Service)
+
+// ClearedQueuePolicy defines how Dequeue behaves on a queue whose clear flag
+// is set by Clear.
+type ClearedQueuePolicy int
+
+const (
+	// ClearedQueueReset removes the clear flag on the next Dequeue, so
+	// members enqueued after the clear are tracked like in a fresh queue.
+	// This is the default.
+	ClearedQueueReset ClearedQueuePolicy = iota
+
+	// ClearedQueueRefuse makes Dequeue return ErrQueueCleared until the
+	// queue is reopened with Reopen.
+	ClearedQueueRefuse
+)
+
+// WithDequeueRetryUntilFull makes Dequeue keep popping until it has collected
+// the requested number of items, retrying up to maxDequeueAttempts times when
+// concurrent consumers drained part of the queue in between.
+//
+// Retrying stops as soon as an attempt returns nothing, so a genuinely empty
+// queue still returns immediately with whatever was collected. This is meant
+// for batch builders and can increase the latency of a single Dequeue call.
+func WithDequeueRetryUntilFull() Option {
+	return func(s *Service) {
+		s.retryUntilFull = true
+	}
+}
+
+// WithClearedQueuePolicy sets the policy applied by Dequeue on a cleared queue.
+func WithClearedQueuePolicy(policy ClearedQueuePolicy) Option {
+	return func(s *Service) {
+		s.clearedPolicy = policy
+	}
+}
+
+// WithMemberHashing stores members under hash(memberID) instead of the plain
+// member ID, keeping sensitive identifiers out of Redis. A nil hash defaults
+// to the hex encoded SHA-256 of the member ID.
+//
+// Every method taking a member ID hashes it before talking to Redis, so lookups
+// keep working with the original IDs. Methods returning members, such as
+// Dequeue and PeekByQueueID, return the hashes: callers must keep their own
+// hash to member ID mapping to resolve them.
+func WithMemberHashing(hash func(string) string) Option {
+	return func(s *Service) {
+		if hash == nil {
+			hash = sha256Hex
+		}
+		s.hashMember = hash
+	}
+}
+
+// sha256Hex returns the hex encoded SHA-256 digest of v.
+func sha256Hex(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithMaxDequeueSet bounds the dequeue set of every queue to n members. After
+// each dequeue the members dequeued the longest time ago are trimmed until the
+// set holds at most n members.
+//
+// This bounds the memory used for IsDequeued tracking at the cost of accuracy:
+// trimmed members no longer report as dequeued. A value <= 0 disables the
+// bound, which is the default.
+func WithMaxDequeueSet(n int64) Option {
+	return func(s *Service) {
+		s.maxDequeueSet = n
+	}
+}
+
+// WithMaxInFlight limits the number of items dequeued with DequeueWithAck and
+// not yet acknowledged to n per queue. Once the limit is reached,
+// DequeueWithAck returns ErrInFlightLimit until Ack frees slots. A value <= 0
+// disables the limit, which is the default.
+func WithMaxInFlight(n int) Option {
+	return func(s *Service) {
+		s.maxInFlight = n
+	}
+}
+
+// WithReadClient routes the read-only methods, such as PeekByQueueID,
+// GetPosition, Contains, IsDequeued and the statistics, to the given client,
+// typically a read replica. Writes and Lua scripts always use the primary
+// client.
+//
+// Because of replication lag, reads may be slightly stale: a member may still
+// be reported at its previous position, or not yet reported at all, right
+// after a write.
+func WithReadClient(replica redis.UniversalClient) Option {
+	return func(s *Service) {
+		s.readClient = replica
+	}
+}
+
+// WithMaxDequeueHistory bounds the dequeue history read by RecentlyDequeued to
+// n entries, trimming the oldest entries after each dequeue.
+//
+// The dequeue set is trimmed together with its history, so this is equivalent
+// to WithMaxDequeueSet: IsDequeued returns false for members trimmed out of
+// the history.
+func WithMaxDequeueHistory(n int64) Option {
+	return WithMaxDequeueSet(n)
+}
+
+// WithDecayModel sets the model used by DecayPriorities to recompute the score
+// of decaying items. The default is DecayLinear.
+func WithDecayModel(model DecayModel) Option {
+	return func(s *Service) {
+		s.decayModel = model
+	}
+}
+
+// WithClearFlagTTL makes the clear flag set by Clear expire after ttl. Once
+// expired, the queue behaves as if it was never cleared. A value <= 0 keeps
+// the flag until Reopen is called, which is the default.
+func WithClearFlagTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl < 0 {
+			ttl = 0
+		}
+		s.clearFlagTTL = ttl
+	}
+}
+
+// WithScoreValidator makes every method taking a caller-provided score, such
+// as Enqueue, SetPriority and their variants, run the score through validate
+// and return its error instead of writing the score when it fails. This lets
+// callers enforce a score convention, e.g. "score must be a plausible future
+// unix millisecond deadline", at the package boundary.
+func WithScoreValidator(validate func(score float64) error) Option {
+	return func(s *Service) {
+		s.validateScores = validate
+	}
+}
+
+// WithScoreJitter makes Enqueue add a random fraction in [0, max) to every
+// score, so members enqueued with the same score get distinct stored scores
+// and are spread out instead of being dequeued in lexical order. Among such
+// members, the dequeue order is random rather than lexical.
+//
+// max must be smaller than the gap between the distinct scores used by the
+// caller, or jittered members may overtake members with a worse score. The
+// stored score is off from the requested one by less than max.
+//
+// Distinct jittered values are limited by the float64 precision around the
+// score: about max/ulp(score) of them, ulp being the spacing between
+// consecutive float64 values at that magnitude. Two of n same-score members
+// therefore collide with a probability of about n²·ulp(score)/(2·max), e.g.
+// roughly 0.6% for 1000 members with a score around 1e6 and a max of 0.01.
+// Large scores, such as unix timestamps, leave little room for jitter.
+//
+// A value <= 0 disables the jitter, which is the default.
+func WithScoreJitter(max float64) Option {
+	return func(s *Service) {
+		s.scoreJitter = max
+	}
+}
+
+// WithCircuitBreaker stops sending commands to Redis for cooldown once
+// threshold consecutive commands failed to reach it, making every method fail
+// fast with ErrCircuitOpen instead of piling up on a dead connection. After
+// the cooldown, a single trial command is let through: the circuit closes if
+// it succeeds and opens again if it fails.
+//
+// Only connection failures and timeouts count as failures; replies such as a
+// missing key or a WRONGTYPE error do not. The breaker is installed as a hook
+// on the Redis client, and on the read client if any, so it also applies to
+// other users of these clients. Hooks cannot be removed, so each Service
+// created with this option needs dedicated clients: NewService fails on a
+// client that already carries a circuit breaker. A threshold <= 0 disables
+// the breaker, which is the default.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(s *Service) {
+		if threshold <= 0 {
+			s.breaker = nil
+			return
+		}
+		s.breaker = &circuitBreaker{
+			threshold: threshold,
+			cooldown:  cooldown,
+		}
+	}
+}
+
+// WithDequeueCooldown makes Dequeue and its variants skip the members that
+// were dequeued less than d ago, popping the next eligible members instead,
+// so that a member re-enqueued right after being dequeued is not processed
+// again too soon. Skipped members keep their place in the queue.
+//
+// The cooldown is honoured by Dequeue and the methods built on it, such as
+// DequeueDetailed and DrainToStream, and by DequeueAgedAtLeast,
+// DequeueSkipLocked, DequeueWithAck, DequeueWithTokens, Lease, Pipe and
+// Reserve, which all start the cooldown of the members they remove. Methods
+// that cannot skip members, namely BlockingDequeue, Consume, ConsumeWith,
+// DequeueBetter, DequeueSharded and DequeueTopBand, return ErrInvalidRequest
+// on a Service created with this option. A value <= 0 disables the cooldown,
+// which is the default.
+func WithDequeueCooldown(d time.Duration) Option {
+	return func(s *Service) {
+		s.cooldown = d
+	}
+}
@@ -0,0 +1,300 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestWithMemberHashing(t *testing.T) {
+	ctx := context.Background()
+	hash := func(id string) string { return "h:" + strings.ToUpper(id) }
+	h := queuetest.New(t, queue.WithMemberHashing(hash))
+	q := h.Service
+
+	for i, id := range []string{"alice", "bob", "carol"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	raw, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRange: %v", err)
+	}
+	if want := []string{"h:ALICE", "h:BOB", "h:CAROL"}; !slices.Equal(raw, want) {
+		t.Fatalf("stored members = %v; want %v", raw, want)
+	}
+
+	if err := q.SetPriority(ctx, &queue.SetPriorityReq{ID: "jobs", MemberID: "carol", Score: -1}); err != nil {
+		t.Fatalf("SetPriority: %v", err)
+	}
+	if position, err := q.GetPosition(ctx, &queue.PositionReq{ID: "jobs", MemberID: "carol"}); err != nil || position != 0 {
+		t.Fatalf("GetPosition(carol) = %d, %v; want 0", position, err)
+	}
+	if err := q.Delete(ctx, &queue.DeleteReq{ID: "jobs", MemberID: "bob"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	for id, want := range map[string]bool{"alice": true, "bob": false, "carol": true} {
+		if ok, err := q.Contains(ctx, "jobs", id); err != nil || ok != want {
+			t.Errorf("Contains(%s) = %v, %v; want %v", id, ok, err, want)
+		}
+	}
+
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2})
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if want := []string{"h:CAROL", "h:ALICE"}; !slices.Equal(got, want) {
+		t.Fatalf("Dequeue = %v; want the hashes %v", got, want)
+	}
+}
+
+// clearAndRefill enqueues a, clears the queue and enqueues b.
+func clearAndRefill(t *testing.T, q *queue.Service) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := q.Clear(ctx, &queue.ClearReq{ID: "jobs", Reason: "reset"}); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "b"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+}
+
+func TestClearedQueueReset(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t, queue.WithClearedQueuePolicy(queue.ClearedQueueReset))
+	clearAndRefill(t, q)
+
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil || !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("Dequeue = %v, %v; want [b]", got, err)
+	}
+	if _, cleared, err := q.ClearInfo(ctx, "jobs"); err != nil || cleared {
+		t.Fatalf("ClearInfo cleared = %v, %v; want the flag reset by Dequeue", cleared, err)
+	}
+}
+
+func TestClearedQueueRefuse(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t, queue.WithClearedQueuePolicy(queue.ClearedQueueRefuse))
+	clearAndRefill(t, q)
+
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); !errors.Is(err, queue.ErrQueueCleared) {
+		t.Fatalf("Dequeue on a cleared queue: %v; want ErrQueueCleared", err)
+	}
+	if ok, err := q.Contains(ctx, "jobs", "b"); err != nil || !ok {
+		t.Fatalf("Contains(b) = %v, %v; want true", ok, err)
+	}
+
+	if err := q.Reopen(ctx, "jobs"); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil || !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("Dequeue after Reopen = %v, %v; want [b]", got, err)
+	}
+}
+
+func TestDequeueRetryUntilFullWithProducer(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t, queue.WithDequeueRetryUntilFull())
+
+	// An empty queue still returns at once.
+	start := time.Now()
+	if got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 10}); err != nil || len(got) != 0 {
+		t.Fatalf("Dequeue on an empty queue = %v, %v; want []", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Dequeue on an empty queue took %v", elapsed)
+	}
+
+	const total, batch = 500, 50
+	produced := make(chan error, 1)
+	go func() {
+		for i := 0; i < total; i++ {
+			if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%d", i), Score: float64(i)}); err != nil {
+				produced <- err
+				return
+			}
+		}
+		produced <- nil
+	}()
+
+	seen := make(map[string]struct{}, total)
+	deadline := time.Now().Add(10 * time.Second)
+	for len(seen) < total && time.Now().Before(deadline) {
+		got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: batch})
+		if err != nil {
+			t.Fatalf("Dequeue: %v", err)
+		}
+		if len(got) > batch {
+			t.Fatalf("Dequeue returned %d items; want at most %d", len(got), batch)
+		}
+		for _, member := range got {
+			if _, ok := seen[member]; ok {
+				t.Fatalf("member %s dequeued twice", member)
+			}
+			seen[member] = struct{}{}
+		}
+	}
+	if err := <-produced; err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if len(seen) != total {
+		t.Fatalf("dequeued %d items; want %d", len(seen), total)
+	}
+}
+
+func TestWithReadClientRoutesReadsToReplica(t *testing.T) {
+	ctx := context.Background()
+	replica := queuetest.New(t)
+	h := queuetest.New(t, queue.WithReadClient(replica.Client))
+	q := h.Service
+
+	// The two servers are never synchronised, so each answer tells which
+	// client served it.
+	for i, id := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if err := replica.Client.ZAdd(ctx, "queue:jobs", redis.Z{Score: 0, Member: "r"}).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	if members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result(); err != nil || !slices.Equal(members, []string{"a", "b"}) {
+		t.Fatalf("primary queue = %v, %v; want the enqueued [a b]", members, err)
+	}
+
+	if head, err := q.PeekByQueueID(ctx, "jobs"); err != nil || head != "r" {
+		t.Errorf("PeekByQueueID = %q, %v; want the replica's r", head, err)
+	}
+	if ok, err := q.Contains(ctx, "jobs", "a"); err != nil || ok {
+		t.Errorf("Contains(a) = %v, %v; want false from the replica", ok, err)
+	}
+	if position, err := q.GetPosition(ctx, &queue.PositionReq{ID: "jobs", MemberID: "r"}); err != nil || position != 0 {
+		t.Errorf("GetPosition(r) = %d, %v; want 0 from the replica", position, err)
+	}
+
+	// Lua scripts run on the primary.
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil || !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("Dequeue = %v, %v; want [a] from the primary", got, err)
+	}
+}
+
+func TestWithMaxDequeueSetCapsTracking(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t, queue.WithMaxDequeueSet(3))
+	q := h.Service
+
+	for i := 0; i < 10; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%d", i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		// Keep each batch in its own millisecond so the oldest entries are
+		// well defined.
+		time.Sleep(2 * time.Millisecond)
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2}); err != nil {
+			t.Fatalf("Dequeue: %v", err)
+		}
+		if size, err := h.Client.SCard(ctx, "dequeue:jobs").Result(); err != nil || size > 3 {
+			t.Fatalf("dequeue set size after batch %d = %d, %v; want at most 3", i, size, err)
+		}
+	}
+
+	for _, id := range []string{"m8", "m9"} {
+		if dequeued, err := q.IsDequeued(ctx, "jobs", id); err != nil || !dequeued {
+			t.Errorf("IsDequeued(%s) = %v, %v; want true", id, dequeued, err)
+		}
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "m0"); err != nil || dequeued {
+		t.Errorf("IsDequeued(m0) = %v, %v; want false once trimmed", dequeued, err)
+	}
+}
+
+func TestWithScoreValidatorRejectsScores(t *testing.T) {
+	ctx := context.Background()
+	errNegative := errors.New("negative score")
+	h := queuetest.New(t, queue.WithScoreValidator(func(score float64) error {
+		if score < 0 {
+			return errNegative
+		}
+		return nil
+	}))
+	q := h.Service
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a", Score: 1}); err != nil {
+		t.Fatalf("Enqueue with a valid score: %v", err)
+	}
+
+	checks := map[string]func() error{
+		"Enqueue": func() error {
+			return q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "b", Score: -1})
+		},
+		"SetPriority": func() error {
+			return q.SetPriority(ctx, &queue.SetPriorityReq{ID: "jobs", MemberID: "a", Score: -1})
+		},
+		"EnqueueBatchDedup": func() error {
+			_, err := q.EnqueueBatchDedup(ctx, "jobs", []queue.EnqueueItem{{MemberID: "c", Score: 2}, {MemberID: "d", Score: -2}})
+			return err
+		},
+		"FanOut": func() error {
+			return q.FanOut(ctx, "e", map[string]float64{"jobs": -3})
+		},
+	}
+	for name, check := range checks {
+		if err := check(); !errors.Is(err, errNegative) {
+			t.Errorf("%s with a negative score: %v; want the validator error", name, err)
+		}
+	}
+
+	got, err := h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if want := []redis.Z{{Score: 1, Member: "a"}}; err != nil || !slices.Equal(got, want) {
+		t.Fatalf("queue = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestWithScoreJitterSpreadsEqualScores(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t, queue.WithScoreJitter(0.5))
+	q := h.Service
+
+	const members = 1000
+	for i := 0; i < members; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%04d", i), Score: 100}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	stored, err := h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || len(stored) != members {
+		t.Fatalf("queue holds %d members, %v; want %d", len(stored), err, members)
+	}
+	seen := make(map[float64]string, members)
+	for _, z := range stored {
+		if z.Score < 100 || z.Score >= 100.5 {
+			t.Errorf("score of %s = %v; want within [100, 100.5)", z.Member, z.Score)
+		}
+		if other, ok := seen[z.Score]; ok {
+			t.Errorf("%s and %s share the stored score %v", other, z.Member, z.Score)
+		}
+		seen[z.Score] = z.Member.(string)
+	}
+}
@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CachedPosition returns the position of a member in the queue, with the
+// first item being 0, caching it for ttl.
+//
+// Calls within ttl of the computation serve the cached value without touching
+// the queue, which offloads ZRANK under read-heavy load. The cache is not
+// invalidated by enqueues or dequeues, so the position can be stale by up to
+// ttl.
+//
+// Returns:
+//   - The position of the member.
+//   - ErrQueueEmpty if the queue is empty.
+//   - ErrMemberNotFound if the member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) CachedPosition(ctx context.Context, queueID, memberID string, ttl time.Duration) (int64, error) {
+	member := q.member(memberID)
+	cacheKey := fmt.Sprintf(positionCacheKey, queueID, member)
+
+	cached, err := q.redisClient.Get(ctx, cacheKey).Int64()
+	if err == nil {
+		return cached, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	position, err := q.reader().
+		ZRank(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			member,
+		).
+		Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, q.missingMember(ctx, queueID)
+	}
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+
+	if err := q.redisClient.Set(ctx, cacheKey, position, ttl).Err(); err != nil {
+		return 0, err
+	}
+	return position, nil
+}
+
+// WillDequeue reports whether the member would be part of the next dequeue of
+// n items, i.e. whether its position is lower than n.
+//
+// Returns:
+//   - true if the member is within the next n items; otherwise, false.
+//   - ErrQueueEmpty if the queue is empty.
+//   - ErrMemberNotFound if the member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) WillDequeue(ctx context.Context, queueID, memberID string, n int64) (bool, error) {
+	position, err := q.reader().
+		ZRank(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			q.member(memberID),
+		).
+		Result()
+	if errors.Is(err, redis.Nil) {
+		return false, q.missingMember(ctx, queueID)
+	}
+	if err != nil {
+		return false, q.queueErr(ctx, queueID, err)
+	}
+	return position < n, nil
+}
+
+// nextMemberScript returns the member following ARGV[1] in the queue in
+// KEYS[1], an empty string if ARGV[1] is the last member, or nil if ARGV[1]
+// is not in the queue.
+var nextMemberScript = redis.NewScript(`
+local rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+if not rank then
+	return false
+end
+local next = redis.call('ZRANGE', KEYS[1], rank + 1, rank + 1)
+if #next == 0 then
+	return ''
+end
+return next[1]
+`)
+
+// NextMember returns the member right after the specified one in dequeue
+// order. The lookup happens atomically in a Lua script, so it is consistent
+// even with concurrent writers.
+//
+// Returns:
+//   - The next member, or an empty string if the member is the last one.
+//   - ErrQueueEmpty if the queue is empty.
+//   - ErrMemberNotFound if the member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) NextMember(ctx context.Context, queueID, memberID string) (string, error) {
+	next, err := nextMemberScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(queueKey, queueID)},
+		q.member(memberID),
+	).
+		Text()
+	if errors.Is(err, redis.Nil) {
+		return "", q.missingMember(ctx, queueID)
+	}
+	if err != nil {
+		return "", q.queueErr(ctx, queueID, err)
+	}
+	return next, nil
+}
+
+// StrictlyAhead returns the number of members with a strictly better (lower)
+// score than the specified member. Unlike GetPosition, members tied with it
+// are not counted, which suits consumers serving equal priorities in parallel.
+//
+// The score is read first and the members ahead are counted afterwards, so
+// the count may be off if the queue is modified in between.
+//
+// Returns:
+//   - The number of members strictly ahead of the member.
+//   - ErrQueueEmpty if the queue is empty.
+//   - ErrMemberNotFound if the member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) StrictlyAhead(ctx context.Context, queueID, memberID string) (uint64, error) {
+	score, err := q.reader().
+		ZScore(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			q.member(memberID),
+		).
+		Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, q.missingMember(ctx, queueID)
+	}
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+
+	ahead, err := q.reader().
+		ZCount(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			"-inf",
+			"("+formatScore(score),
+		).
+		Uint64()
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	return ahead, nil
+}
+
+// PositionForScore returns the position an item enqueued now with the given
+// score would take, with the first item being 0: the number of members with a
+// strictly better (lower) score. The queue is not modified, and an empty queue
+// gives 0.
+//
+// Among members sharing the score, the actual position of a new item depends
+// on the lexical order of the member IDs, so it may end up further back.
+//
+// Returns:
+//   - The position an item with the given score would take.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) PositionForScore(ctx context.Context, queueID string, score float64) (uint64, error) {
+	position, err := q.reader().
+		ZCount(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			"-inf",
+			"("+formatScore(score),
+		).
+		Uint64()
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	return position, nil
+}
+
+// memberAtPositionScript returns the length of the queue in KEYS[1] and the
+// list of members at rank ARGV[1], empty when out of range.
+var memberAtPositionScript = redis.NewScript(`
+return {
+	redis.call('ZCARD', KEYS[1]),
+	redis.call('ZRANGE', KEYS[1], ARGV[1], ARGV[1]),
+}
+`)
+
+// MemberAtPosition returns the member at the given position of the queue,
+// with the first item being 0. It is the inverse of GetPosition.
+//
+// Returns:
+//   - The member at the given position.
+//   - ErrQueueEmpty if the queue is empty.
+//   - ErrInvalidRequest if position is negative or not below the queue length.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) MemberAtPosition(ctx context.Context, queueID string, position int64) (string, error) {
+	if position < 0 {
+		return "", fmt.Errorf("%w: negative position %d", ErrInvalidRequest, position)
+	}
+
+	vals, err := memberAtPositionScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(queueKey, queueID)},
+		position,
+	).
+		Slice()
+	if err != nil {
+		return "", q.queueErr(ctx, queueID, err)
+	}
+	if len(vals) != 2 {
+		return "", fmt.Errorf("unexpected position reply length %d", len(vals))
+	}
+
+	length, _ := vals[0].(int64)
+	if length == 0 {
+		return "", ErrQueueEmpty
+	}
+	members := toStrings(vals[1])
+	if len(members) == 0 {
+		return "", fmt.Errorf("%w: position %d out of range, queue length is %d", ErrInvalidRequest, position, length)
+	}
+	return members[0], nil
+}
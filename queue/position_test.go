@@ -0,0 +1,227 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestPositionLookupsOnEmptyQueue(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	lookups := map[string]func() error{
+		"CachedPosition": func() error {
+			_, err := q.CachedPosition(ctx, "jobs", "a", time.Minute)
+			return err
+		},
+		"WillDequeue": func() error {
+			_, err := q.WillDequeue(ctx, "jobs", "a", 1)
+			return err
+		},
+		"NextMember": func() error {
+			_, err := q.NextMember(ctx, "jobs", "a")
+			return err
+		},
+		"StrictlyAhead": func() error {
+			_, err := q.StrictlyAhead(ctx, "jobs", "a")
+			return err
+		},
+		"RankDistance": func() error {
+			_, err := q.RankDistance(ctx, "jobs", "a", "b")
+			return err
+		},
+	}
+
+	for name, lookup := range lookups {
+		if err := lookup(); !errors.Is(err, queue.ErrQueueEmpty) {
+			t.Errorf("%s on an empty queue = %v; want ErrQueueEmpty", name, err)
+		}
+	}
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "c"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	for name, lookup := range lookups {
+		if err := lookup(); !errors.Is(err, queue.ErrMemberNotFound) {
+			t.Errorf("%s of a missing member = %v; want ErrMemberNotFound", name, err)
+		}
+	}
+}
+
+func TestCachedPositionReusedWithinTTL(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if position, err := q.CachedPosition(ctx, "jobs", "c", time.Minute); err != nil || position != 2 {
+		t.Fatalf("CachedPosition = %d, %v; want 2", position, err)
+	}
+
+	// The head leaves, but the cached position is served until the TTL
+	// elapses.
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	h.FastForward(30 * time.Second)
+	if position, err := q.CachedPosition(ctx, "jobs", "c", time.Minute); err != nil || position != 2 {
+		t.Fatalf("CachedPosition within the TTL = %d, %v; want the cached 2", position, err)
+	}
+
+	h.FastForward(time.Minute)
+	if position, err := q.CachedPosition(ctx, "jobs", "c", time.Minute); err != nil || position != 1 {
+		t.Fatalf("CachedPosition after the TTL = %d, %v; want 1", position, err)
+	}
+
+	if _, err := q.CachedPosition(ctx, "jobs", "missing", time.Minute); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("CachedPosition of a missing member: %v; want ErrMemberNotFound", err)
+	}
+}
+
+func TestWillDequeueBatchWindow(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	tests := []struct {
+		member string
+		n      int64
+		want   bool
+	}{
+		{"a", 1, true},
+		{"b", 1, false},
+		{"c", 3, true},
+		{"d", 3, false},
+		{"d", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := q.WillDequeue(ctx, "jobs", tt.member, tt.n)
+		if err != nil || got != tt.want {
+			t.Errorf("WillDequeue(%s, %d) = %v, %v; want %v", tt.member, tt.n, got, err, tt.want)
+		}
+	}
+
+	if _, err := q.WillDequeue(ctx, "jobs", "missing", 10); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("WillDequeue of a missing member: %v; want ErrMemberNotFound", err)
+	}
+}
+
+func TestNextMember(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for member, want := range map[string]string{"a": "b", "b": "c", "c": ""} {
+		next, err := q.NextMember(ctx, "jobs", member)
+		if err != nil || next != want {
+			t.Errorf("NextMember(%s) = %q, %v; want %q", member, next, err, want)
+		}
+	}
+	if _, err := q.NextMember(ctx, "jobs", "missing"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("NextMember of a missing member: %v; want ErrMemberNotFound", err)
+	}
+}
+
+func TestStrictlyAheadIgnoresTies(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for _, req := range []queue.EnqueueReq{
+		{ID: "jobs", MemberID: "a", Score: 1},
+		{ID: "jobs", MemberID: "b", Score: 2},
+		{ID: "jobs", MemberID: "c", Score: 2},
+		{ID: "jobs", MemberID: "d", Score: 2},
+		{ID: "jobs", MemberID: "e", Score: 3},
+	} {
+		if err := q.Enqueue(ctx, &req); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for member, want := range map[string]uint64{"a": 0, "b": 1, "d": 1, "e": 4} {
+		ahead, err := q.StrictlyAhead(ctx, "jobs", member)
+		if err != nil || ahead != want {
+			t.Errorf("StrictlyAhead(%s) = %d, %v; want %d", member, ahead, err, want)
+		}
+	}
+	if position, err := q.GetPosition(ctx, &queue.PositionReq{ID: "jobs", MemberID: "d"}); err != nil || position != 3 {
+		t.Fatalf("GetPosition(d) = %d, %v; want 3", position, err)
+	}
+	if _, err := q.StrictlyAhead(ctx, "jobs", "missing"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("StrictlyAhead of a missing member: %v; want ErrMemberNotFound", err)
+	}
+}
+
+func TestPositionForScore(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	if position, err := q.PositionForScore(ctx, "jobs", 5); err != nil || position != 0 {
+		t.Fatalf("PositionForScore on an empty queue = %d, %v; want 0", position, err)
+	}
+	for i, score := range []float64{1, 2, 2, 4} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: string(rune('a' + i)), Score: score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for score, want := range map[float64]uint64{0: 0, 1: 0, 2: 1, 3: 3, 4: 3, 9: 4} {
+		position, err := q.PositionForScore(ctx, "jobs", score)
+		if err != nil || position != want {
+			t.Errorf("PositionForScore(%v) = %d, %v; want %d", score, position, err, want)
+		}
+	}
+
+	// The queue is left untouched.
+	if waiting, _, err := q.Progress(ctx, "jobs"); err != nil || waiting != 4 {
+		t.Fatalf("queue length = %d, %v; want 4", waiting, err)
+	}
+}
+
+func TestMemberAtPositionInvertsGetPosition(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	if _, err := q.MemberAtPosition(ctx, "jobs", 0); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("MemberAtPosition on an empty queue: %v; want ErrQueueEmpty", err)
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		position, err := q.GetPosition(ctx, &queue.PositionReq{ID: "jobs", MemberID: id})
+		if err != nil {
+			t.Fatalf("GetPosition(%s): %v", id, err)
+		}
+		if member, err := q.MemberAtPosition(ctx, "jobs", int64(position)); err != nil || member != id {
+			t.Errorf("MemberAtPosition(%d) = %q, %v; want %q", position, member, err, id)
+		}
+	}
+	for _, position := range []int64{-1, 3} {
+		if _, err := q.MemberAtPosition(ctx, "jobs", position); !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("MemberAtPosition(%d): %v; want ErrInvalidRequest", position, err)
+		}
+	}
+}
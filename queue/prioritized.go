@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// PriorityScale is the score distance between two consecutive priority
+	// levels of EnqueuePrioritized: one level spans PriorityScale milliseconds,
+	// about 31.7 years.
+	PriorityScale = 1e12
+
+	// MaxPriority bounds the absolute priority accepted by EnqueuePrioritized,
+	// so that every score is exactly representable as a float64 with
+	// millisecond resolution.
+	MaxPriority = 8000
+)
+
+// PriorityEpoch is the origin of the timestamps encoded by
+// EnqueuePrioritized. Timestamps must be within
+// [PriorityEpoch, PriorityEpoch+PriorityScale milliseconds).
+var PriorityEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// EnqueuePrioritized adds an item to the queue with a score encoding a strict
+// priority level followed by its timestamp:
+//
+//	score = priority*PriorityScale + milliseconds since PriorityEpoch
+//
+// Lower priorities are dequeued first and, within a priority level, earlier
+// timestamps are dequeued first, so Dequeue and PeekByQueueID yield strict
+// priority then FIFO order. Timestamps are truncated to milliseconds; two
+// items of the same level enqueued within the same millisecond are ordered
+// lexically.
+//
+// Returns:
+//   - ErrInvalidRequest if |priority| exceeds MaxPriority or at is outside the
+//     supported range.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueuePrioritized(ctx context.Context, queueID, memberID string, priority int, at time.Time) error {
+	if priority > MaxPriority || priority < -MaxPriority {
+		return ErrInvalidRequest
+	}
+	offset := at.Sub(PriorityEpoch).Milliseconds()
+	if offset < 0 || offset >= PriorityScale {
+		return ErrInvalidRequest
+	}
+
+	return q.Enqueue(ctx, &EnqueueReq{
+		ID:       queueID,
+		MemberID: memberID,
+		Score:    float64(priority)*PriorityScale + float64(offset),
+	})
+}
@@ -0,0 +1,62 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestEnqueuePrioritizedOrdersByPriorityThenTime(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	base := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	items := []struct {
+		member   string
+		priority int
+		at       time.Time
+	}{
+		{"low-early", 2, base},
+		{"high-late", 1, base.Add(time.Hour)},
+		{"high-early", 1, base.Add(time.Millisecond)},
+		{"urgent", -1, base.Add(24 * time.Hour)},
+		{"low-late", 2, base.Add(time.Second)},
+	}
+	for _, item := range items {
+		if err := q.EnqueuePrioritized(ctx, "jobs", item.member, item.priority, item.at); err != nil {
+			t.Fatalf("EnqueuePrioritized(%s): %v", item.member, err)
+		}
+	}
+
+	want := []string{"urgent", "high-early", "high-late", "low-early", "low-late"}
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: len(want)})
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("Dequeue = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestEnqueuePrioritizedRejectsOutOfRange(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	tests := []struct {
+		name     string
+		priority int
+		at       time.Time
+	}{
+		{"priority too high", queue.MaxPriority + 1, queue.PriorityEpoch},
+		{"priority too low", -queue.MaxPriority - 1, queue.PriorityEpoch},
+		{"before the epoch", 0, queue.PriorityEpoch.Add(-time.Millisecond)},
+		{"past the scale", 0, queue.PriorityEpoch.Add(queue.PriorityScale * time.Millisecond)},
+	}
+	for _, tt := range tests {
+		if err := q.EnqueuePrioritized(ctx, "jobs", "a", tt.priority, tt.at); !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("EnqueuePrioritized with %s: %v; want ErrInvalidRequest", tt.name, err)
+		}
+	}
+}
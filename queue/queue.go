@@ -2,12 +2,36 @@ package queue
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-var ErrQueueEmpty = fmt.Errorf("queue is empty")
+// Methods reading a single item, such as PeekByQueueID, GetPosition or Cycle,
+// return ErrQueueEmpty when the queue is empty, and ErrMemberNotFound when the
+// requested member is not in a non-empty queue. Methods reading a batch of
+// items, such as Dequeue or PreviewScoreRange, return an empty, non-nil slice
+// and a nil error instead.
+var (
+	ErrQueueEmpty      = fmt.Errorf("queue is empty")
+	ErrMemberNotFound  = fmt.Errorf("member not found")
+	ErrQueueCleared    = fmt.Errorf("queue is cleared")
+	ErrInFlightLimit   = fmt.Errorf("in-flight limit reached")
+	ErrInvalidRequest  = fmt.Errorf("invalid request")
+	ErrKeyTypeConflict = fmt.Errorf("key holds a value of the wrong type")
+	ErrStaleToken      = fmt.Errorf("stale fencing token")
+	ErrLeaseNotFound   = fmt.Errorf("lease not found")
+	ErrCircuitOpen     = fmt.Errorf("circuit breaker is open")
+	ErrDequeueTimeout  = fmt.Errorf("dequeue timed out")
+)
 
 const (
 	// queueKey is the key used to store the queue in Redis.
@@ -21,25 +45,166 @@ const (
 
 	// idxKey is the key used to store the index in Redis.
 	idxKey = "idx:%s"
+
+	// throughputKey is the key used to store the cumulative dequeued count in Redis.
+	throughputKey = "throughput:%s"
+
+	// totalDequeuedKey is the key used to store the never reset count of
+	// items ever dequeued in Redis.
+	totalDequeuedKey = "total_dequeued:%s"
+
+	// dequeuedScoreKey is the key used to store the score each dequeued item
+	// had in the queue in Redis.
+	dequeuedScoreKey = "dequeued_score:%s"
+
+	// dequeueHistoryKey is the key used to store the dequeued items scored by
+	// their dequeue time (unix milliseconds) in Redis.
+	dequeueHistoryKey = "dequeue_history:%s"
+
+	// inFlightKey is the key used to store the dequeued but not yet acknowledged
+	// items scored by their visibility deadline (unix milliseconds) in Redis.
+	inFlightKey = "inflight:%s"
+
+	// inFlightScoreKey is the key used to store the score each in-flight item
+	// had in the queue in Redis.
+	inFlightScoreKey = "inflight_score:%s"
+
+	// inFlightTokenKey is the key used to store the fencing token of each
+	// in-flight item in Redis.
+	inFlightTokenKey = "inflight_token:%s"
+
+	// fencingSeqKey is the key used to store the last fencing token issued for
+	// a queue in Redis.
+	fencingSeqKey = "fencing_seq:%s"
+
+	// dequeueStatsKey is the key used to store the dequeue batch size
+	// statistics in Redis.
+	dequeueStatsKey = "dequeue_stats:%s"
+
+	// updateCountKey is the key used to store the number of times the score
+	// of each queued item was changed in Redis. Entries are dropped when
+	// items leave the queue.
+	updateCountKey = "update_count:%s"
+
+	// decayKey is the key used to store the base score, last touch time and
+	// decay rate of decaying items in Redis.
+	decayKey = "decay:%s"
+
+	// positionCacheKey is the key used to cache the position of a member of a
+	// queue in Redis.
+	positionCacheKey = "position:%s:%s"
+
+	// processingStartKey is the key used to store the processing start time
+	// (unix milliseconds) of items dequeued with DequeueTimed in Redis.
+	processingStartKey = "processing_start:%s"
+
+	// processingDurationKey is the key used to store the processing duration
+	// (milliseconds) of completed items in Redis.
+	processingDurationKey = "processing_duration:%s"
+
+	// enqueuedAtKey is the key used to store the time (unix milliseconds)
+	// each item was added to the queue in Redis. Entries are dropped when
+	// items leave the queue.
+	enqueuedAtKey = "enqueued_at:%s"
+
+	// redeliveriesKey is the key used to store the number of times in-flight
+	// items expired and were redelivered in Redis.
+	redeliveriesKey = "redeliveries:%s"
+
+	// attemptsKey is the key used to store the attempt count of the items
+	// enqueued with EnqueueRetry in Redis. Entries are dropped when items
+	// leave the queue.
+	attemptsKey = "attempts:%s"
+
+	// deadLetterKey is the key used to store the dead-lettered items scored by
+	// their dead-letter time (unix milliseconds) in Redis.
+	deadLetterKey = "dlq:%s"
+
+	// deadLetterReasonKey is the key used to store the reason each item was
+	// dead-lettered for in Redis.
+	deadLetterReasonKey = "dlq_reason:%s"
+
+	// leasedKey is the key used to store the leased items, keyed by lease
+	// token, with their expiry (unix milliseconds) and score in Redis.
+	leasedKey = "leased:%s"
+
+	// reservationKey is the key used to store the items reserved under a
+	// lease ID, with their score, in Redis.
+	reservationKey = "reservation:%s:%s"
+
+	// reservationsKey is the key used to store the lease IDs of the
+	// reservations of a queue scored by their expiry (unix milliseconds) in
+	// Redis.
+	reservationsKey = "reservations:%s"
+
+	// cooldownKey is the key used to store the recently dequeued items
+	// scored by their dequeue time (unix milliseconds) in Redis, for
+	// WithDequeueCooldown.
+	cooldownKey = "cooldown:%s"
+
+	// lockKey is the key used to lock a single member of a queue in Redis.
+	lockKey = "lock:%s:%s"
+
+	// maxDequeueAttempts bounds the number of pops performed by a single Dequeue
+	// call when WithDequeueRetryUntilFull is enabled.
+	maxDequeueAttempts = 5
 )
 
 // Service represents a service for enqueueing and dequeueing items from a Redis instance.
 type Service struct {
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
+	readClient  redis.UniversalClient
+
+	retryUntilFull bool
+	hashMember     func(string) string
+	clearedPolicy  ClearedQueuePolicy
+	maxDequeueSet  int64
+	maxInFlight    int
+	decayModel     DecayModel
+	validateScores func(float64) error
+	scoreJitter    float64
+	clearFlagTTL   time.Duration
+	breaker        *circuitBreaker
+	cooldown       time.Duration
 }
 
 // NewService returns a new Service for enqueueing and dequeueing items from a Redis instance.
 //
+// redisClient may be a *redis.Client, or a *redis.ClusterClient, *redis.Ring or
+// failover client. With Redis Cluster, every key of a queue must live in the
+// same hash slot for the Lua scripts and transactions to work: use queue IDs
+// with a hash tag, such as "{orders}", and the same hash tag for queues used
+// together, e.g. by MoveWhere or Pipe.
+//
+// With WithCircuitBreaker, ErrInvalidRequest is returned if one of the clients
+// already carries a circuit breaker.
+//
 // The context.Context is not used in this function and is only present for forward
 // compatibility.
-func NewService(ctx context.Context, redisClient *redis.Client) (*Service, error) {
-	if redisClient == nil {
+func NewService(ctx context.Context, redisClient redis.UniversalClient, opts ...Option) (*Service, error) {
+	if isNilClient(redisClient) {
 		return nil, fmt.Errorf("redis client is nil")
 	}
 
-	return &Service{
+	s := &Service{
 		redisClient: redisClient,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.readClient != nil && isNilClient(s.readClient) {
+		return nil, fmt.Errorf("read client is nil")
+	}
+	if s.breaker != nil {
+		clients := []redis.UniversalClient{s.redisClient}
+		if s.readClient != nil && s.readClient != s.redisClient {
+			clients = append(clients, s.readClient)
+		}
+		if err := s.breaker.install(clients...); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 // EnqueueReq represents a request to enqueue an item into a queue.
@@ -52,6 +217,15 @@ type EnqueueReq struct {
 
 	// Priority score (lower is higher priority)
 	Score float64
+
+	// SecondarySort, if set, orders items sharing the same Score by this key
+	// instead of by member ID, lower first. Score and SecondarySort are then
+	// stored as the composite score Score*SecondarySortScale+SecondarySort:
+	// Score must be an integer within ±MaxSecondaryPrimary and SecondarySort
+	// an integer within [0, 2^32), so that the composite score is exact. Use
+	// GetPrimaryScore and GetSecondarySort to decode stored scores. Score
+	// jitter (see WithScoreJitter) is not applied to such items.
+	SecondarySort *float64
 }
 
 // Enqueue adds an item to the Redis queue with a specified priority score.
@@ -59,6 +233,8 @@ type EnqueueReq struct {
 // The item's priority is determined by the score value, where lower scores
 // indicate higher priority. The function uses the Redis ZAdd command to
 // add the item to a sorted set corresponding to the queue specified by in.ID.
+// The enqueue time is recorded alongside, for DequeueAgedAtLeast; enqueueing
+// an item that is already queued keeps its original enqueue time.
 //
 //   - ctx: The context for the request, used for cancellation and timeouts.
 //   - in: A pointer to an EnqueueReq containing the queue ID, the item ID (MemberID),
@@ -67,15 +243,166 @@ type EnqueueReq struct {
 // Returns:
 //   - An error if the operation fails; otherwise, nil.
 func (q *Service) Enqueue(ctx context.Context, in *EnqueueReq) error {
-	return q.redisClient.
-		ZAdd(
-			ctx,
-			fmt.Sprintf(queueKey, in.ID),
-			redis.Z{
-				Score:  in.Score,
-				Member: in.MemberID,
-			}).
+	score, err := q.compositeScore(in)
+	if err != nil {
+		return err
+	}
+	if in.SecondarySort == nil {
+		score = q.jitter(score)
+	}
+
+	member := q.member(in.MemberID)
+
+	pipe := q.redisClient.Pipeline()
+	pipe.ZAdd(
+		ctx,
+		fmt.Sprintf(queueKey, in.ID),
+		redis.Z{
+			Score:  score,
+			Member: member,
+		})
+	pipe.HSetNX(ctx, fmt.Sprintf(enqueuedAtKey, in.ID), member, time.Now().UnixMilli())
+	_, err = pipe.Exec(ctx)
+	return q.queueErr(ctx, in.ID, err)
+}
+
+// pushScript adds the member ARGV[1] to the queue in KEYS[1] scored with the
+// next value of the sequence in KEYS[2], recording the enqueue time ARGV[2]
+// in KEYS[3].
+var pushScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[2])
+redis.call('ZADD', KEYS[1], seq, ARGV[1])
+redis.call('HSETNX', KEYS[3], ARGV[1], ARGV[2])
+return seq
+`)
+
+// Push adds an item to the back of the queue without requiring a score.
+//
+// The item is scored with the next value of a per-queue sequence, so items
+// pushed this way are dequeued in FIFO order. Mixing Push with Enqueue works
+// as long as the explicit scores are chosen with the sequence in mind.
+//
+// Returns:
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Push(ctx context.Context, queueID, memberID string) error {
+	err := pushScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(idxKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		q.member(memberID),
+		time.Now().UnixMilli(),
+	).
 		Err()
+	return q.queueErr(ctx, queueID, err)
+}
+
+// EnqueueItem represents a single item of a batch enqueue.
+type EnqueueItem struct {
+	// The unique identifier of the item being enqueued.
+	MemberID string
+
+	// Priority score (lower is higher priority)
+	Score float64
+}
+
+// Member represents an item of a queue together with its score.
+type Member struct {
+	// MemberID is the unique identifier of the item.
+	MemberID string
+
+	// Score is the score of the item.
+	Score float64
+}
+
+// EnqueueBatchDedup adds the given items to the queue, skipping every item
+// whose member is already present.
+//
+// The whole batch is sent as a single ZADD NX, so re-seeding a queue never
+// resets the scores of existing members.
+//
+// Returns:
+//   - The number of newly added members.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) EnqueueBatchDedup(ctx context.Context, queueID string, items []EnqueueItem) (int64, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	members := make([]redis.Z, 0, len(items))
+	for _, item := range items {
+		if err := q.validateScore(item.Score); err != nil {
+			return 0, err
+		}
+		members = append(members, redis.Z{
+			Score:  item.Score,
+			Member: q.member(item.MemberID),
+		})
+	}
+
+	now := time.Now().UnixMilli()
+	pipe := q.redisClient.Pipeline()
+	added := pipe.ZAddNX(ctx, fmt.Sprintf(queueKey, queueID), members...)
+	for _, z := range members {
+		pipe.HSetNX(ctx, fmt.Sprintf(enqueuedAtKey, queueID), z.Member.(string), now)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	return added.Val(), nil
+}
+
+// Replace atomically replaces the content of the queue with the given items.
+//
+// The existing queue is deleted and the new items are inserted in a single
+// MULTI/EXEC transaction, so consumers never observe an empty or partially
+// populated queue. All items are recorded as enqueued now, with no update or
+// attempt count. When resetDequeued is true, the dequeue tracking of the queue
+// is deleted as well; otherwise it is preserved.
+//
+// Returns:
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Replace(ctx context.Context, queueID string, items []EnqueueItem, resetDequeued bool) error {
+	members := make([]redis.Z, 0, len(items))
+	for _, item := range items {
+		if err := q.validateScore(item.Score); err != nil {
+			return err
+		}
+		members = append(members, redis.Z{
+			Score:  item.Score,
+			Member: q.member(item.MemberID),
+		})
+	}
+
+	now := time.Now().UnixMilli()
+	_, err := q.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+			fmt.Sprintf(attemptsKey, queueID),
+		)
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, fmt.Sprintf(queueKey, queueID), members...)
+			for _, z := range members {
+				pipe.HSet(ctx, fmt.Sprintf(enqueuedAtKey, queueID), z.Member.(string), now)
+			}
+		}
+		if resetDequeued {
+			pipe.Del(
+				ctx,
+				fmt.Sprintf(dequeueKey, queueID),
+				fmt.Sprintf(dequeueHistoryKey, queueID),
+				fmt.Sprintf(dequeuedScoreKey, queueID),
+			)
+		}
+		return nil
+	})
+	return q.queueErr(ctx, queueID, err)
 }
 
 // DequeueReq represents a request to dequeue an item from a queue.
@@ -86,6 +413,20 @@ type DequeueReq struct {
 	// Number is the number of items to dequeue.
 	// If 0, a single item is dequeued by default.
 	Number int
+
+	// MinScore, if set, restricts the dequeue to items whose score is at
+	// least MinScore, leaving more urgent items in the queue.
+	MinScore *float64
+
+	// IncludeRanks makes DequeueDetailed report the rank each item had
+	// before removal.
+	IncludeRanks bool
+
+	// SkipTracking leaves the removed items out of the dequeue set, its
+	// history and the recorded dequeue scores for this call only. IsDequeued,
+	// RecentlyDequeued and RequeuePreservingScore then ignore these items;
+	// the throughput counter still counts them.
+	SkipTracking bool
 }
 
 // Dequeue removes one or more items from the specified queue.
@@ -95,10 +436,97 @@ type DequeueReq struct {
 // field in the request is greater than 1, it removes multiple items up to the specified
 // number. If it is 0 or not specified, a single item is removed by default.
 //
+// If the queue has been cleared, the behaviour follows the Service's
+// ClearedQueuePolicy: by default the clear flag is reset and the queue is
+// treated as a fresh one, with ClearedQueueRefuse ErrQueueCleared is returned
+// until Reopen is called.
+//
+// When in.MinScore is set, only items with a score of at least MinScore are
+// removed; more urgent items are left untouched.
+//
+// When the Service is created with WithDequeueRetryUntilFull, Dequeue keeps
+// popping until it has collected the requested number of items or the queue
+// is empty.
+//
 // Returns:
 //   - A slice of strings containing the dequeued item IDs.
-//   - An error if the operation fails; otherwise, nil.
+//   - An error if the operation fails; otherwise, nil. Items already removed
+//     from the queue when a later step fails are returned along with the
+//     error, so that they are not lost.
 func (q *Service) Dequeue(ctx context.Context, in *DequeueReq) ([]string, error) {
+	popped, err := q.dequeue(ctx, in)
+	return memberIDs(popped), q.queueErr(ctx, in.ID, err)
+}
+
+// ScoredMember represents an item removed from a queue together with the
+// score it had. It is the same type as Member.
+type ScoredMember = Member
+
+// DequeueWithScores removes one or more items from the specified queue like
+// Dequeue, but returns the score every item had in the queue, e.g. for SLA
+// accounting or logging.
+//
+// Returns:
+//   - A slice of ScoredMember in dequeue order, lowest score first.
+//   - An error if the operation fails; otherwise, nil. Items already removed
+//     from the queue when a later step fails are returned along with the
+//     error, so that they are not lost.
+func (q *Service) DequeueWithScores(ctx context.Context, in *DequeueReq) ([]ScoredMember, error) {
+	popped, err := q.dequeue(ctx, in)
+	return toMembers(popped), q.queueErr(ctx, in.ID, err)
+}
+
+// RankedMember represents an item removed from a queue together with the
+// score and rank it had before removal.
+type RankedMember struct {
+	// MemberID is the unique identifier of the item.
+	MemberID string
+
+	// Score is the priority score the item had in the queue.
+	Score float64
+
+	// Rank is the 0-based position the item had in the queue.
+	// It is only set when DequeueReq.IncludeRanks is true.
+	Rank int64
+}
+
+// DequeueDetailed removes one or more items from the specified queue like
+// Dequeue, but returns the score of every removed item and, when
+// in.IncludeRanks is set, the rank it had before removal.
+//
+// Since Dequeue always removes the head of the queue, the ranks are 0..n-1 in
+// the returned order. When in.MinScore is set, ranks are relative to the items
+// eligible for removal.
+//
+// Returns:
+//   - A slice of RankedMember in dequeue order.
+//   - An error if the operation fails; otherwise, nil. Items already removed
+//     from the queue when a later step fails are returned along with the
+//     error, so that they are not lost.
+func (q *Service) DequeueDetailed(ctx context.Context, in *DequeueReq) ([]RankedMember, error) {
+	popped, err := q.dequeue(ctx, in)
+
+	members := make([]RankedMember, 0, len(popped))
+	for i, z := range popped {
+		m := RankedMember{
+			MemberID: z.Member.(string),
+			Score:    z.Score,
+		}
+		if in.IncludeRanks {
+			m.Rank = int64(i)
+		}
+		members = append(members, m)
+	}
+	return members, q.queueErr(ctx, in.ID, err)
+}
+
+// dequeue implements Dequeue and returns the removed items with their scores,
+// including those removed before an error.
+func (q *Service) dequeue(ctx context.Context, in *DequeueReq) ([]redis.Z, error) {
+	if err := q.checkCleared(ctx, in.ID); err != nil {
+		return nil, err
+	}
+
 	queueLen, err := q.redisClient.
 		ZCard(
 			ctx,
@@ -106,49 +534,138 @@ func (q *Service) Dequeue(ctx context.Context, in *DequeueReq) ([]string, error)
 		).
 		Uint64()
 	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
 	if queueLen == 0 {
-		return []string{}, nil
+		return nil, nil
 	}
 
-	if in.Number > 1 {
-		return dequeueByRank(ctx, q.redisClient, in.ID, int64(in.Number-1))
+	popped, err := q.popBatch(ctx, in)
+	if err != nil || len(popped) == 0 {
+		return popped, err
 	}
 
-	return dequeueByRank(ctx, q.redisClient, in.ID, 0)
+	// The items are out of the queue and recorded already, so failing to
+	// update the batch size statistics must not fail the dequeue.
+	_ = recordBatchSizeScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(dequeueStatsKey, in.ID)},
+		len(popped),
+	).
+		Err()
+	return popped, nil
+}
+
+// popBatch pops the items requested by in, retrying when the Service is
+// created with WithDequeueRetryUntilFull.
+func (q *Service) popBatch(ctx context.Context, in *DequeueReq) ([]redis.Z, error) {
+	number := in.Number
+	if number < 1 {
+		number = 1
+	}
+	min := "-inf"
+	if in.MinScore != nil {
+		min = formatScore(*in.MinScore)
+	}
+	pop := func(n int) ([]redis.Z, error) {
+		return q.dequeueN(ctx, in.ID, n, min, !in.SkipTracking)
+	}
+
+	popped, err := pop(number)
+	if err != nil || !q.retryUntilFull {
+		return popped, err
+	}
+
+	seen := make(map[string]struct{}, len(popped))
+	for _, z := range popped {
+		seen[z.Member.(string)] = struct{}{}
+	}
+	for attempt := 1; attempt < maxDequeueAttempts && len(popped) < number; attempt++ {
+		more, err := pop(number - len(popped))
+		if err != nil {
+			return popped, err
+		}
+		if len(more) == 0 {
+			break
+		}
+		for _, z := range more {
+			if _, ok := seen[z.Member.(string)]; ok {
+				continue
+			}
+			seen[z.Member.(string)] = struct{}{}
+			popped = append(popped, z)
+		}
+	}
+
+	return popped, nil
+}
+
+// ClearReq represents a request to clear a queue.
+type ClearReq struct {
+	// The unique identifier for the queue.
+	ID string
+
+	// Reason is recorded in the clear flag for auditing.
+	Reason string
+}
+
+// ClearInfo represents the metadata stored in the clear flag of a queue.
+type ClearInfo struct {
+	// ClearedAt is the time the queue was cleared.
+	ClearedAt time.Time `json:"clearedAt"`
+
+	// Reason is the reason given when clearing the queue.
+	Reason string `json:"reason"`
 }
 
-func (q *Service) Clear(ctx context.Context, queueID string) error {
+// Clear removes every item from the specified queue and sets its clear flag,
+// recording when and why the queue was cleared. Clearing an empty queue is a
+// no-op.
+//
+// The clear flag expires after the TTL configured with WithClearFlagTTL, and
+// never expires by default.
+//
+// Returns:
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Clear(ctx context.Context, in *ClearReq) error {
 	queueLen, err := q.redisClient.
 		ZCard(
 			ctx,
-			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(queueKey, in.ID),
 		).
 		Uint64()
 	if err != nil {
-		return err
+		return q.queueErr(ctx, in.ID, err)
 	}
 	if queueLen == 0 {
 		return nil
 	}
 
-	err = q.redisClient.
-		ZRemRangeByScore(
-			ctx,
-			fmt.Sprintf(queueKey, queueID),
-			"-inf", "+inf",
-		).
-		Err()
+	_, err = q.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, fmt.Sprintf(queueKey, in.ID), "-inf", "+inf")
+		pipe.Del(ctx, fmt.Sprintf(enqueuedAtKey, in.ID))
+		pipe.Del(ctx, fmt.Sprintf(updateCountKey, in.ID))
+		pipe.Del(ctx, fmt.Sprintf(attemptsKey, in.ID))
+		return nil
+	})
+	if err != nil {
+		return q.queueErr(ctx, in.ID, err)
+	}
+
+	info, err := json.Marshal(ClearInfo{
+		ClearedAt: time.Now(),
+		Reason:    in.Reason,
+	})
 	if err != nil {
 		return err
 	}
 
 	if err := q.redisClient.Set(
 		ctx,
-		fmt.Sprintf(clearKey, queueID),
-		true,
-		0,
+		fmt.Sprintf(clearKey, in.ID),
+		info,
+		q.clearFlagTTL,
 	).
 		Err(); err != nil {
 		return err
@@ -156,15 +673,142 @@ func (q *Service) Clear(ctx context.Context, queueID string) error {
 	return nil
 }
 
-// PeekByQueueID returns the first item in the specified queue.
+// ClearInfo returns the metadata recorded by the last Clear of the queue.
 //
-// The function returns an empty string and an error if the queue is empty.
+// Returns:
+//   - The clear metadata, or nil if the clear flag is not set.
+//   - true if the clear flag is set; otherwise, false.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ClearInfo(ctx context.Context, queueID string) (*ClearInfo, bool, error) {
+	raw, err := q.reader().
+		Get(
+			ctx,
+			fmt.Sprintf(clearKey, queueID),
+		).
+		Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	info := &ClearInfo{}
+	if err := json.Unmarshal(raw, info); err != nil {
+		return nil, true, err
+	}
+	return info, true, nil
+}
+
+// Reopen removes the clear flag set by Clear, so the queue is treated as a
+// fresh one again.
+//
+// Returns:
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Reopen(ctx context.Context, queueID string) error {
+	return q.redisClient.
+		Del(
+			ctx,
+			fmt.Sprintf(clearKey, queueID),
+		).
+		Err()
+}
+
+// queueKeys lists the formats of the keys storing the state of a queue, with
+// the Redis type of the value each of them holds.
+var queueKeys = []struct {
+	format string
+	typ    string
+}{
+	{queueKey, "zset"},
+	{dequeueKey, "set"},
+	{clearKey, "string"},
+	{idxKey, "string"},
+	{throughputKey, "string"},
+	{totalDequeuedKey, "string"},
+	{dequeuedScoreKey, "hash"},
+	{dequeueHistoryKey, "zset"},
+	{inFlightKey, "zset"},
+	{inFlightScoreKey, "hash"},
+	{inFlightTokenKey, "hash"},
+	{fencingSeqKey, "string"},
+	{dequeueStatsKey, "hash"},
+	{updateCountKey, "hash"},
+	{decayKey, "hash"},
+	{processingStartKey, "hash"},
+	{processingDurationKey, "hash"},
+	{enqueuedAtKey, "hash"},
+	{redeliveriesKey, "hash"},
+	{attemptsKey, "hash"},
+	{deadLetterKey, "zset"},
+	{deadLetterReasonKey, "hash"},
+	{leasedKey, "hash"},
+	{reservationsKey, "zset"},
+	{cooldownKey, "zset"},
+}
+
+// DeleteQueue deletes the queue together with all of its state: in-flight,
+// leased, reserved and dead-lettered items, dequeue tracking, statistics and
+// counters, including the LifetimeDequeued count. The queue ID can then be
+// reused as a brand new queue.
+//
+// Position caches and member locks are not deleted but expire on their own.
+//
+// Returns:
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DeleteQueue(ctx context.Context, queueID string) error {
+	leaseIDs, err := q.redisClient.
+		ZRange(
+			ctx,
+			fmt.Sprintf(reservationsKey, queueID),
+			0,
+			-1,
+		).
+		Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(queueKeys)+len(leaseIDs))
+	for _, key := range queueKeys {
+		keys = append(keys, fmt.Sprintf(key.format, queueID))
+	}
+	for _, leaseID := range leaseIDs {
+		keys = append(keys, fmt.Sprintf(reservationKey, queueID, leaseID))
+	}
+	return q.redisClient.Del(ctx, keys...).Err()
+}
+
+// checkCleared applies the Service's ClearedQueuePolicy when the clear flag is
+// set on the queue.
+func (q *Service) checkCleared(ctx context.Context, queueID string) error {
+	isCleared, err := q.redisClient.
+		Exists(
+			ctx,
+			fmt.Sprintf(clearKey, queueID),
+		).
+		Result()
+	if err != nil {
+		return err
+	}
+	if isCleared == 0 {
+		return nil
+	}
+
+	if q.clearedPolicy == ClearedQueueRefuse {
+		return ErrQueueCleared
+	}
+	return q.Reopen(ctx, queueID)
+}
+
+// PeekByQueueID returns the first item in the specified queue.
 //
 // Returns:
-//   - The first item in the queue, or an empty string if the queue is empty.
+//   - The first item in the queue.
+//   - ErrQueueEmpty if the queue is empty.
 //   - An error if the operation fails; otherwise, nil.
 func (q *Service) PeekByQueueID(ctx context.Context, queueID string) (string, error) {
-	members, err := q.redisClient.
+	members, err := q.reader().
 		ZRange(
 			ctx,
 			fmt.Sprintf(queueKey, queueID),
@@ -173,7 +817,7 @@ func (q *Service) PeekByQueueID(ctx context.Context, queueID string) (string, er
 		).
 		Result()
 	if err != nil {
-		return "", err
+		return "", q.queueErr(ctx, queueID, err)
 	}
 	if len(members) == 0 {
 		return "", ErrQueueEmpty
@@ -192,26 +836,76 @@ type PositionReq struct {
 
 // GetPosition returns the position of an item in a queue, with the first item being 0.
 //
-// The function returns an error if the queue is empty.
+// Returns:
+//   - The position of the item.
+//   - ErrQueueEmpty if the queue is empty.
+//   - ErrMemberNotFound if the item is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
 func (q *Service) GetPosition(ctx context.Context, in *PositionReq) (uint64, error) {
-	count, err := q.redisClient.ZCard(
+	count, err := q.reader().ZCard(
 		ctx,
 		fmt.Sprintf(queueKey, in.ID),
 	).
 		Uint64()
 	if err != nil {
-		return 0, err
+		return 0, q.queueErr(ctx, in.ID, err)
 	}
 	if count == 0 {
 		return 0, ErrQueueEmpty
 	}
 
-	return q.redisClient.
+	position, err := q.reader().
 		ZRank(ctx,
 			fmt.Sprintf(queueKey, in.ID),
-			in.MemberID,
+			q.member(in.MemberID),
 		).
 		Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrMemberNotFound
+	}
+	if err != nil {
+		return 0, q.queueErr(ctx, in.ID, err)
+	}
+	return position, nil
+}
+
+// RankDistance returns how many positions separate memberB from memberA,
+// computed as rankB - rankA. The result is negative when memberB is ahead of
+// memberA.
+//
+// Both ranks are read in a single pipeline.
+//
+// Returns:
+//   - The rank distance between the two members.
+//   - ErrQueueEmpty if the queue is empty.
+//   - ErrMemberNotFound if either member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RankDistance(ctx context.Context, queueID, memberA, memberB string) (int64, error) {
+	key := fmt.Sprintf(queueKey, queueID)
+
+	pipe := q.reader().Pipeline()
+	rankA := pipe.ZRank(ctx, key, q.member(memberA))
+	rankB := pipe.ZRank(ctx, key, q.member(memberB))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+
+	a, err := rankA.Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, q.missingMember(ctx, queueID)
+	}
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	b, err := rankB.Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, q.missingMember(ctx, queueID)
+	}
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+
+	return b - a, nil
 }
 
 // SetPriorityReq represents a request to set or update the priority score of an item in a queue.
@@ -227,23 +921,77 @@ type SetPriorityReq struct {
 	Score float64
 }
 
+// setPriorityScript scores the member ARGV[1] of the queue in KEYS[1] with
+// ARGV[2] and drops its decay record in KEYS[2]. If the member was already
+// queued with a different score, its update count in KEYS[3] is incremented;
+// if it was not queued, the enqueue time ARGV[3] is recorded in KEYS[4].
+var setPriorityScript = redis.NewScript(`
+local previous = redis.call('ZSCORE', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if not previous then
+	redis.call('HSET', KEYS[4], ARGV[1], ARGV[3])
+elseif tonumber(previous) ~= tonumber(ARGV[2]) then
+	redis.call('HINCRBY', KEYS[3], ARGV[1], 1)
+end
+return 1
+`)
+
 // SetPriority sets or updates the priority score of an item in a queue.
 //
 // The function behavior is as follows:
 //   - If the item does not exist in the queue, it is added with the given score.
-//   - If the item already exists in the queue, its score is updated.
+//   - If the item already exists in the queue, its score is updated and, if
+//     the score changed, its update count (see UpdateCount) is incremented.
+//   - If the item decays (see RefreshPriority), its decay record is dropped so
+//     the new score is not overwritten by DecayPriorities.
 //
 // Returns:
 //   - An error if the operation fails; otherwise, nil.
 func (q *Service) SetPriority(ctx context.Context, in *SetPriorityReq) error {
-	return q.redisClient.ZAdd(
+	if err := q.validateScore(in.Score); err != nil {
+		return err
+	}
+
+	err := setPriorityScript.Run(
 		ctx,
-		fmt.Sprintf(queueKey, in.ID),
-		redis.Z{
-			Score:  in.Score,
-			Member: in.MemberID,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, in.ID),
+			fmt.Sprintf(decayKey, in.ID),
+			fmt.Sprintf(updateCountKey, in.ID),
+			fmt.Sprintf(enqueuedAtKey, in.ID),
 		},
-	).Err()
+		q.member(in.MemberID),
+		formatScore(in.Score),
+		time.Now().UnixMilli(),
+	).
+		Err()
+	return q.queueErr(ctx, in.ID, err)
+}
+
+// UpdateCount returns how many times the score of the member changed while it
+// was queued, which reveals thrashing priorities. SetPriority, Nudge,
+// MoveAhead, MoveBehind, EnqueueBehind of a queued member, ShiftAllScores,
+// ScaleScores and Reconcile count as changes; re-enqueueing with Enqueue does
+// not. The count starts over once the member leaves the queue, and members
+// never rescored report 0.
+//
+// Returns:
+//   - The number of score changes of the member.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) UpdateCount(ctx context.Context, queueID, memberID string) (int64, error) {
+	count, err := q.reader().
+		HGet(
+			ctx,
+			fmt.Sprintf(updateCountKey, queueID),
+			q.member(memberID),
+		).
+		Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return count, err
 }
 
 // DeleteReq represents a request to delete an item from a queue.
@@ -260,12 +1008,37 @@ type DeleteReq struct {
 // Returns:
 //   - An error if the operation fails; otherwise, nil.
 func (q *Service) Delete(ctx context.Context, in *DeleteReq) error {
-	return q.redisClient.
-		ZRem(
+	member := q.member(in.MemberID)
+
+	pipe := q.redisClient.TxPipeline()
+	pipe.ZRem(ctx, fmt.Sprintf(queueKey, in.ID), member)
+	pipe.HDel(ctx, fmt.Sprintf(enqueuedAtKey, in.ID), member)
+	pipe.HDel(ctx, fmt.Sprintf(updateCountKey, in.ID), member)
+	pipe.HDel(ctx, fmt.Sprintf(attemptsKey, in.ID), member)
+	_, err := pipe.Exec(ctx)
+	return q.queueErr(ctx, in.ID, err)
+}
+
+// Contains reports whether the specified item is currently in the queue.
+//
+// Returns:
+//   - true if the item is in the queue; otherwise, false.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Contains(ctx context.Context, queueID, memberID string) (bool, error) {
+	err := q.reader().
+		ZScore(
 			ctx,
-			fmt.Sprintf(queueKey, in.ID),
-			in.MemberID,
-		).Err()
+			fmt.Sprintf(queueKey, queueID),
+			q.member(memberID),
+		).
+		Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, q.queueErr(ctx, queueID, err)
+	}
+	return true, nil
 }
 
 // IsDequeued returns true if the specified item has been dequeued from the queue.
@@ -275,7 +1048,7 @@ func (q *Service) Delete(ctx context.Context, in *DeleteReq) error {
 //
 // The function returns an error if the operation fails; otherwise, nil.
 func (q *Service) IsDequeued(ctx context.Context, queueID string, memberID string) (bool, error) {
-	isCleared, err := q.redisClient.
+	isCleared, err := q.reader().
 		Exists(
 			ctx,
 			fmt.Sprintf(clearKey, queueID),
@@ -285,52 +1058,202 @@ func (q *Service) IsDequeued(ctx context.Context, queueID string, memberID strin
 		return true, nil
 	}
 
-	isDequeued, err := q.redisClient.
+	isDequeued, err := q.reader().
 		SIsMember(
 			ctx,
 			fmt.Sprintf(dequeueKey, queueID),
-			memberID,
+			q.member(memberID),
 		).
 		Result()
 	if err != nil {
-		return false, err
+		return false, q.queueErr(ctx, queueID, err)
 	}
 
 	return isDequeued, nil
 }
 
-func dequeueByRank(ctx context.Context, redisClient *redis.Client, queueID string, stop int64) ([]string, error) {
-	members, err := redisClient.
-		ZRange(
+// validateScore runs the score validator configured with WithScoreValidator,
+// if any.
+func (q *Service) validateScore(score float64) error {
+	if q.validateScores == nil {
+		return nil
+	}
+	return q.validateScores(score)
+}
+
+// jitter adds a random fraction in [0, max) to score, where max is set by
+// WithScoreJitter.
+func (q *Service) jitter(score float64) float64 {
+	if q.scoreJitter <= 0 {
+		return score
+	}
+	return score + rand.Float64()*q.scoreJitter
+}
+
+// reader returns the client used by read-only methods.
+func (q *Service) reader() redis.Cmdable {
+	if q.readClient == nil {
+		return q.redisClient
+	}
+	return q.readClient
+}
+
+// queueErr wraps a WRONGTYPE error returned while operating on the queue into
+// ErrKeyTypeConflict naming the offending key, so that a queue ID colliding
+// with a key of another type is easy to diagnose.
+func (q *Service) queueErr(ctx context.Context, queueID string, err error) error {
+	return q.queuesErr(ctx, err, queueID)
+}
+
+// queuesErr is queueErr for an operation spanning several queues. The
+// offending key is found by checking the type of every key of the queues; the
+// key of the first queue is named if none of them holds an unexpected type
+// anymore.
+func (q *Service) queuesErr(ctx context.Context, err error, queueIDs ...string) error {
+	if err == nil || errors.Is(err, ErrKeyTypeConflict) || !strings.Contains(err.Error(), "WRONGTYPE") {
+		return err
+	}
+
+	pipe := q.redisClient.Pipeline()
+	types := make([]*redis.StatusCmd, 0, len(queueIDs)*len(queueKeys))
+	for _, queueID := range queueIDs {
+		for _, key := range queueKeys {
+			types = append(types, pipe.Type(ctx, fmt.Sprintf(key.format, queueID)))
+		}
+	}
+	if _, typeErr := pipe.Exec(ctx); typeErr == nil {
+		for i, cmd := range types {
+			key := queueKeys[i%len(queueKeys)]
+			if typ := cmd.Val(); typ != "none" && typ != key.typ {
+				return fmt.Errorf("%w: %s holds a %s, expected a %s: %v", ErrKeyTypeConflict, cmd.Args()[1], typ, key.typ, err)
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s: %v", ErrKeyTypeConflict, fmt.Sprintf(queueKey, queueIDs[0]), err)
+}
+
+// missingMember returns the error of a method that did not find a member in
+// the queue: ErrQueueEmpty if the queue is empty, ErrMemberNotFound otherwise.
+func (q *Service) missingMember(ctx context.Context, queueID string) error {
+	count, err := q.reader().
+		ZCard(
 			ctx,
 			fmt.Sprintf(queueKey, queueID),
-			0,
-			stop,
 		).
 		Result()
 	if err != nil {
-		return []string{}, err
+		return q.queueErr(ctx, queueID, err)
+	}
+	if count == 0 {
+		return ErrQueueEmpty
 	}
+	return ErrMemberNotFound
+}
 
-	err = redisClient.
-		ZRemRangeByRank(
-			ctx,
-			fmt.Sprintf(queueKey, queueID),
-			0,
-			stop,
-		).
-		Err()
-	if err != nil {
-		return []string{}, err
+// isNilClient reports whether client is nil, including a nil pointer of a
+// concrete client type such as a nil *redis.Client, which does not compare
+// equal to a nil interface.
+func isNilClient(client redis.UniversalClient) bool {
+	if client == nil {
+		return true
 	}
+	v := reflect.ValueOf(client)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
 
-	if err := redisClient.SAdd(
-		ctx,
-		fmt.Sprintf(dequeueKey, queueID),
-		members,
-	).Err(); err != nil {
-		return []string{}, err
+// member returns the identifier under which the given member ID is stored in
+// Redis.
+func (q *Service) member(memberID string) string {
+	if q.hashMember == nil {
+		return memberID
+	}
+	return q.hashMember(memberID)
+}
+
+// recordBatchSizeScript adds a dequeue of ARGV[1] items to the batch size
+// statistics in KEYS[1].
+var recordBatchSizeScript = redis.NewScript(`
+redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('HINCRBY', KEYS[1], 'total', ARGV[1])
+local max = tonumber(redis.call('HGET', KEYS[1], 'max') or '0')
+if tonumber(ARGV[1]) > max then
+	redis.call('HSET', KEYS[1], 'max', ARGV[1])
+end
+return 1
+`)
+
+// memberIDs returns the members of the given sorted set entries.
+func memberIDs(zs []redis.Z) []string {
+	members := make([]string, 0, len(zs))
+	for _, z := range zs {
+		members = append(members, z.Member.(string))
+	}
+	return members
+}
+
+// formatScore formats a score as a score range bound.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "+inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// memberArgs returns the members of the given sorted set entries as command
+// arguments.
+func memberArgs(zs []redis.Z) []interface{} {
+	members := make([]interface{}, 0, len(zs))
+	for _, z := range zs {
+		members = append(members, z.Member)
+	}
+	return members
+}
+
+// toMembers converts sorted set entries into Members.
+func toMembers(zs []redis.Z) []Member {
+	members := make([]Member, 0, len(zs))
+	for _, z := range zs {
+		members = append(members, Member{
+			MemberID: z.Member.(string),
+			Score:    z.Score,
+		})
 	}
+	return members
+}
 
-	return members, nil
+// toStrings converts an array reply of a Lua script into strings.
+func toStrings(val interface{}) []string {
+	vals, _ := val.([]interface{})
+	strs := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if str, ok := v.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+// parseScored converts a flat member, score, member, score... reply of a Lua
+// script into sorted set entries.
+func parseScored(vals []interface{}) ([]redis.Z, error) {
+	zs := make([]redis.Z, 0, len(vals)/2)
+	for i := 0; i+1 < len(vals); i += 2 {
+		member, ok := vals[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected member type %T", vals[i])
+		}
+		raw, ok := vals[i+1].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected score type %T", vals[i+1])
+		}
+		score, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, err
+		}
+		zs = append(zs, redis.Z{Score: score, Member: member})
+	}
+	return zs, nil
 }
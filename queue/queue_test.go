@@ -0,0 +1,576 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDequeueConcurrentNoDuplicates(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	const items = 1000
+	for i := 0; i < items; i++ {
+		err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%04d", i), Score: float64(i)})
+		if err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]int, items)
+		wg   sync.WaitGroup
+	)
+	for g := 0; g < 50; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 7})
+				if err != nil {
+					t.Errorf("Dequeue: %v", err)
+					return
+				}
+				if len(got) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, id := range got {
+					seen[id]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != items {
+		t.Fatalf("dequeued %d distinct items; want %d", len(seen), items)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("%s dequeued %d times", id, n)
+		}
+		dequeued, err := q.IsDequeued(ctx, "jobs", id)
+		if err != nil || !dequeued {
+			t.Fatalf("IsDequeued(%s) = %v, %v; want true", id, dequeued, err)
+		}
+	}
+
+	total, err := q.LifetimeDequeued(ctx, "jobs")
+	if err != nil || total != items {
+		t.Fatalf("LifetimeDequeued = %d, %v; want %d", total, err, items)
+	}
+}
+
+func TestDequeueSkipTracking(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	for _, id := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2, SkipTracking: true}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+
+	dequeued, err := q.IsDequeued(ctx, "jobs", "a")
+	if err != nil || dequeued {
+		t.Fatalf("IsDequeued(a) = %v, %v; want false", dequeued, err)
+	}
+	throughput, err := q.Throughput(ctx, "jobs")
+	if err != nil || throughput != 2 {
+		t.Fatalf("Throughput = %d, %v; want 2", throughput, err)
+	}
+}
+
+func TestDeleteQueue(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if _, err := q.Reserve(ctx, "jobs", 1, "lease", time.Minute); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if err := q.SendToDeadLetter(ctx, "jobs", "c", "poison"); err != nil {
+		t.Fatalf("SendToDeadLetter: %v", err)
+	}
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "other", MemberID: "x"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	if err := q.DeleteQueue(ctx, "jobs"); err != nil {
+		t.Fatalf("DeleteQueue: %v", err)
+	}
+	for _, key := range h.Server.Keys() {
+		if !strings.HasSuffix(key, ":other") {
+			t.Errorf("key %q left after DeleteQueue", key)
+		}
+	}
+}
+
+func TestDequeueMinScoreLeavesUrgentItems(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	for i, id := range []string{"urgent", "low1", "low2", "low3"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i * 10)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	floor := 10.0
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2, MinScore: &floor})
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if want := []string{"low1", "low2"}; !slices.Equal(got, want) {
+		t.Fatalf("Dequeue = %v; want %v", got, want)
+	}
+
+	head, err := q.PeekByQueueID(ctx, "jobs")
+	if err != nil || head != "urgent" {
+		t.Fatalf("PeekByQueueID = %q, %v; want urgent", head, err)
+	}
+}
+
+func TestUpdateCount(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if err := q.SetPriority(ctx, &queue.SetPriorityReq{ID: "jobs", MemberID: "c", Score: 5}); err != nil {
+		t.Fatalf("SetPriority: %v", err)
+	}
+	if err := q.MoveAhead(ctx, "jobs", "c", "a"); err != nil {
+		t.Fatalf("MoveAhead: %v", err)
+	}
+	if _, err := q.ShiftAllScores(ctx, "jobs", 10); err != nil {
+		t.Fatalf("ShiftAllScores: %v", err)
+	}
+
+	count, err := q.UpdateCount(ctx, "jobs", "c")
+	if err != nil || count != 3 {
+		t.Fatalf("UpdateCount(c) = %d, %v; want 3", count, err)
+	}
+
+	// c is the head now; its count starts over once dequeued.
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "c"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	count, err = q.UpdateCount(ctx, "jobs", "c")
+	if err != nil || count != 0 {
+		t.Fatalf("UpdateCount(c) after dequeue = %d, %v; want 0", count, err)
+	}
+
+	if err := q.Delete(ctx, &queue.DeleteReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	count, err = q.UpdateCount(ctx, "jobs", "a")
+	if err != nil || count != 0 {
+		t.Fatalf("UpdateCount(a) after Delete = %d, %v; want 0", count, err)
+	}
+
+	// Every other way of taking a member out of the queue drops its count too.
+	removals := []struct {
+		name   string
+		remove func(q *queue.Service) error
+	}{
+		{"ClearWhere", func(q *queue.Service) error {
+			_, err := q.ClearWhere(ctx, "jobs", func(member string, _ float64) bool { return member == "a" })
+			return err
+		}},
+		{"ClearExcept", func(q *queue.Service) error {
+			_, err := q.ClearExcept(ctx, "jobs", []string{"head"})
+			return err
+		}},
+		{"DedupMembers", func(q *queue.Service) error {
+			_, err := q.DedupMembers(ctx, "jobs", func(string) string { return "same" })
+			return err
+		}},
+		{"EnqueueBounded", func(q *queue.Service) error {
+			_, err := q.EnqueueBounded(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "b", Score: 1}, 2)
+			return err
+		}},
+		{"EnqueueDeadlineBounded", func(q *queue.Service) error {
+			_, err := q.EnqueueDeadlineBounded(ctx, "jobs", "b", time.UnixMilli(1), 2)
+			return err
+		}},
+		{"MoveWhere", func(q *queue.Service) error {
+			_, err := q.MoveWhere(ctx, "jobs", "other", func(member string, _ float64) bool { return member == "a" })
+			return err
+		}},
+		{"Partition", func(q *queue.Service) error {
+			_, err := q.Partition(ctx, "jobs", func(member string, _ float64) string {
+				if member == "a" {
+					return "other"
+				}
+				return ""
+			})
+			return err
+		}},
+		{"SendToDeadLetter", func(q *queue.Service) error {
+			return q.SendToDeadLetter(ctx, "jobs", "a", "poison")
+		}},
+		{"Replace", func(q *queue.Service) error {
+			return q.Replace(ctx, "jobs", []queue.EnqueueItem{{MemberID: "a", Score: 100}}, false)
+		}},
+	}
+	for _, tt := range removals {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := queuetest.NewTestService(t)
+			if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "head", Score: 0}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a", Score: 50}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			if err := q.SetPriority(ctx, &queue.SetPriorityReq{ID: "jobs", MemberID: "a", Score: 100}); err != nil {
+				t.Fatalf("SetPriority: %v", err)
+			}
+
+			if err := tt.remove(q); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if count, err := q.UpdateCount(ctx, "jobs", "a"); err != nil || count != 0 {
+				t.Fatalf("UpdateCount(a) = %d, %v; want 0", count, err)
+			}
+		})
+	}
+}
+
+func TestDequeueIgnoresStatsFailure(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for _, id := range []string{"a", "b"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	// A key of the wrong type makes the statistics update fail.
+	if err := h.Client.Set(ctx, "dequeue_stats:jobs", "x", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2})
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if want := []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("Dequeue = %v; want %v", got, want)
+	}
+}
+
+// scoreClient is a redis.UniversalClient answering ZSCORE from a map. Any
+// other command panics on the nil embedded interface.
+type scoreClient struct {
+	redis.UniversalClient
+	scores map[string]float64
+}
+
+func (c *scoreClient) ZScore(ctx context.Context, key, member string) *redis.FloatCmd {
+	score, ok := c.scores[key+" "+member]
+	if !ok {
+		return redis.NewFloatResult(0, redis.Nil)
+	}
+	return redis.NewFloatResult(score, nil)
+}
+
+func TestNewServiceAcceptsUniversalClient(t *testing.T) {
+	ctx := context.Background()
+	client := &scoreClient{scores: map[string]float64{"queue:jobs a": 1}}
+
+	q, err := queue.NewService(ctx, client)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	for member, want := range map[string]bool{"a": true, "b": false} {
+		got, err := q.Contains(ctx, "jobs", member)
+		if err != nil || got != want {
+			t.Errorf("Contains(%s) = %v, %v; want %v", member, got, err, want)
+		}
+	}
+}
+
+func TestNewServiceRejectsNilClient(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := queue.NewService(ctx, nil); err == nil {
+		t.Error("NewService(nil) succeeded")
+	}
+	var client *redis.Client
+	if _, err := queue.NewService(ctx, client); err == nil {
+		t.Error("NewService with a nil *redis.Client succeeded")
+	}
+	var replica *redis.ClusterClient
+	if _, err := queue.NewService(ctx, &scoreClient{}, queue.WithReadClient(replica)); err == nil {
+		t.Error("NewService with a nil read client succeeded")
+	}
+}
+
+func TestKeyTypeConflictNamesKey(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for _, key := range []string{"enqueued_at:jobs", "queue:dst", "queue:sharded:1"} {
+		if err := h.Client.Set(ctx, key, "x", 0).Err(); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	if err := h.Client.ZAdd(ctx, "queue:src", redis.Z{Member: "a"}).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	checks := map[string]func() error{
+		"enqueued_at:jobs": func() error {
+			return q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"})
+		},
+		"queue:dst": func() error {
+			_, err := q.Pipe(ctx, "src", "dst", 1, 0)
+			return err
+		},
+		"queue:sharded:1": func() error {
+			_, err := q.DequeueSharded(ctx, "sharded", 2, 1)
+			return err
+		},
+	}
+	for key, check := range checks {
+		err := check()
+		if !errors.Is(err, queue.ErrKeyTypeConflict) || !strings.Contains(err.Error(), key) {
+			t.Errorf("error = %v; want ErrKeyTypeConflict naming %s", err, key)
+		}
+	}
+}
+
+func TestRankDistance(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	if _, err := q.RankDistance(ctx, "jobs", "a", "b"); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("RankDistance on an empty queue: %v; want ErrQueueEmpty", err)
+	}
+
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	tests := []struct {
+		a, b string
+		want int64
+	}{
+		{"a", "d", 3},
+		{"d", "b", -2},
+		{"c", "c", 0},
+	}
+	for _, tt := range tests {
+		distance, err := q.RankDistance(ctx, "jobs", tt.a, tt.b)
+		if err != nil || distance != tt.want {
+			t.Errorf("RankDistance(%s, %s) = %d, %v; want %d", tt.a, tt.b, distance, err, tt.want)
+		}
+	}
+
+	for _, pair := range [][2]string{{"a", "missing"}, {"missing", "a"}} {
+		if _, err := q.RankDistance(ctx, "jobs", pair[0], pair[1]); !errors.Is(err, queue.ErrMemberNotFound) {
+			t.Errorf("RankDistance(%s, %s): %v; want ErrMemberNotFound", pair[0], pair[1], err)
+		}
+	}
+}
+
+func TestReplaceObserversSeeFullSets(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	sets := make([][]queue.EnqueueItem, 2)
+	names := make([][]string, 2)
+	for i, prefix := range []string{"old", "new"} {
+		for j := 0; j < 50; j++ {
+			id := fmt.Sprintf("%s-%02d", prefix, j)
+			sets[i] = append(sets[i], queue.EnqueueItem{MemberID: id, Score: float64(j)})
+			names[i] = append(names[i], id)
+		}
+	}
+	if err := q.Replace(ctx, "jobs", sets[0], false); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+
+	stop := make(chan struct{})
+	observed := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				observed <- nil
+				return
+			default:
+			}
+			members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+			if err != nil {
+				observed <- err
+				return
+			}
+			if !slices.Equal(members, names[0]) && !slices.Equal(members, names[1]) {
+				observed <- fmt.Errorf("observed a partial queue of %d members: %v", len(members), members)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if err := q.Replace(ctx, "jobs", sets[(i+1)%2], false); err != nil {
+			t.Fatalf("Replace: %v", err)
+		}
+	}
+	close(stop)
+	if err := <-observed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClearInfoMetadataAndTTL(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t, queue.WithClearFlagTTL(time.Minute))
+	q := h.Service
+
+	if _, cleared, err := q.ClearInfo(ctx, "jobs"); err != nil || cleared {
+		t.Fatalf("ClearInfo before Clear: cleared = %v, %v; want false", cleared, err)
+	}
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	before := time.Now()
+	if err := q.Clear(ctx, &queue.ClearReq{ID: "jobs", Reason: "nightly reset"}); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	info, cleared, err := q.ClearInfo(ctx, "jobs")
+	if err != nil || !cleared {
+		t.Fatalf("ClearInfo: cleared = %v, %v; want true", cleared, err)
+	}
+	if info.Reason != "nightly reset" {
+		t.Errorf("Reason = %q; want %q", info.Reason, "nightly reset")
+	}
+	if info.ClearedAt.Before(before.Truncate(time.Second)) || info.ClearedAt.After(time.Now()) {
+		t.Errorf("ClearedAt = %v; want between %v and now", info.ClearedAt, before)
+	}
+
+	h.FastForward(30 * time.Second)
+	if _, cleared, err := q.ClearInfo(ctx, "jobs"); err != nil || !cleared {
+		t.Fatalf("ClearInfo before the TTL elapsed: cleared = %v, %v; want true", cleared, err)
+	}
+	h.FastForward(time.Minute)
+	if info, cleared, err := q.ClearInfo(ctx, "jobs"); err != nil || cleared || info != nil {
+		t.Fatalf("ClearInfo after the TTL elapsed = %v, %v, %v; want nil, false", info, cleared, err)
+	}
+}
+
+func TestEnqueueBatchDedupKeepsExistingScores(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if added, err := q.EnqueueBatchDedup(ctx, "jobs", nil); err != nil || added != 0 {
+		t.Fatalf("EnqueueBatchDedup(nil) = %d, %v; want 0", added, err)
+	}
+	if added, err := q.EnqueueBatchDedup(ctx, "jobs", []queue.EnqueueItem{
+		{MemberID: "a", Score: 1},
+		{MemberID: "b", Score: 2},
+	}); err != nil || added != 2 {
+		t.Fatalf("EnqueueBatchDedup = %d, %v; want 2", added, err)
+	}
+
+	added, err := q.EnqueueBatchDedup(ctx, "jobs", []queue.EnqueueItem{
+		{MemberID: "a", Score: 10},
+		{MemberID: "b", Score: 20},
+		{MemberID: "c", Score: 3},
+	})
+	if err != nil || added != 1 {
+		t.Fatalf("EnqueueBatchDedup over existing members = %d, %v; want 1", added, err)
+	}
+
+	want := map[string]float64{"a": 1, "b": 2, "c": 3}
+	for member, score := range want {
+		got, err := h.Client.ZScore(ctx, "queue:jobs", member).Result()
+		if err != nil || got != score {
+			t.Errorf("score of %s = %v, %v; want %v", member, got, err, score)
+		}
+	}
+}
+
+func TestPushDequeuesInFIFOOrder(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	want := []string{"c", "a", "d", "b"}
+	for _, id := range want {
+		if err := q.Push(ctx, "jobs", id); err != nil {
+			t.Fatalf("Push(%s): %v", id, err)
+		}
+	}
+
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: len(want)})
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("Dequeue = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestDequeueWithScoresLowestFirst(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	if got, err := q.DequeueWithScores(ctx, &queue.DequeueReq{ID: "jobs", Number: 2}); err != nil || len(got) != 0 {
+		t.Fatalf("DequeueWithScores on an empty queue = %v, %v; want none", got, err)
+	}
+	for _, item := range []queue.EnqueueItem{{MemberID: "c", Score: 7.5}, {MemberID: "a", Score: -1}, {MemberID: "b", Score: 2}} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: item.MemberID, Score: item.Score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	got, err := q.DequeueWithScores(ctx, &queue.DequeueReq{ID: "jobs", Number: 2})
+	want := []queue.ScoredMember{{MemberID: "a", Score: -1}, {MemberID: "b", Score: 2}}
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("DequeueWithScores = %v, %v; want %v", got, err, want)
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "b"); err != nil || !dequeued {
+		t.Fatalf("IsDequeued(b) = %v, %v; want true", dequeued, err)
+	}
+
+	// Dequeue keeps returning the member IDs only.
+	if ids, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil || !slices.Equal(ids, []string{"c"}) {
+		t.Fatalf("Dequeue = %v, %v; want [c]", ids, err)
+	}
+}
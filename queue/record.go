@@ -0,0 +1,244 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dequeueLua is prepended to the Lua scripts removing items from a queue, so
+// that the removal and its bookkeeping happen atomically. Such scripts take
+// the keys returned by dequeueKeys and the arguments returned by dequeueArgs
+// first, followed by their own, and can call:
+//   - take(n, min, skip), which removes up to n members with a score of at
+//     least min from the queue, in priority order, and returns them as a flat
+//     member/score list. Members dequeued less than the WithDequeueCooldown
+//     duration ago are left in place, as are the members for which the
+//     optional skip function, called with each member and its score, returns
+//     true.
+//   - forget(members), which drops the per-member metadata of members that
+//     left the queue.
+//   - record(popped), which updates the dequeue counters for a flat
+//     member/score list and, unless tracking is skipped, adds the members to
+//     the dequeue set, its history and the dequeue scores.
+//
+// These functions act on the queue whose keys are in the keys table, KEYS by
+// default. A script spanning several queues can pass the keys of each queue
+// in turn, as returned by dequeueKeys, and point keys at those of the queue to
+// work on.
+const dequeueLua = `
+local track = ARGV[1] == '1'
+local now = tonumber(ARGV[2])
+local cooldown = tonumber(ARGV[3])
+local maxTracked = tonumber(ARGV[4])
+local keys = KEYS
+
+local function chunked(cmd, key, list)
+	for i = 1, #list, 1000 do
+		redis.call(cmd, key, unpack(list, i, math.min(i + 999, #list)))
+	end
+end
+
+local function membersOf(popped)
+	local members = {}
+	for i = 1, #popped, 2 do
+		table.insert(members, popped[i])
+	end
+	return members
+end
+
+local function forget(members)
+	chunked('HDEL', keys[7], members)
+	chunked('HDEL', keys[9], members)
+	chunked('HDEL', keys[10], members)
+end
+
+local function cooling(member)
+	if cooldown <= 0 then
+		return false
+	end
+	local at = redis.call('ZSCORE', keys[8], member)
+	return at and tonumber(at) > now - cooldown
+end
+
+local function take(n, min, skip)
+	local popped, members = {}, {}
+	local page = n
+	if skip or cooldown > 0 then
+		page = 100
+	end
+	local start = 0
+	while #members < n do
+		local batch = redis.call('ZRANGEBYSCORE', keys[1], min, '+inf', 'WITHSCORES', 'LIMIT', start, page)
+		for i = 1, #batch, 2 do
+			if #members >= n then
+				break
+			end
+			if not cooling(batch[i]) and not (skip and skip(batch[i], batch[i + 1])) then
+				table.insert(members, batch[i])
+				table.insert(popped, batch[i])
+				table.insert(popped, batch[i + 1])
+			end
+		end
+		if #batch < 2 * page then
+			break
+		end
+		start = start + page
+	end
+	chunked('ZREM', keys[1], members)
+	forget(members)
+	if cooldown > 0 and #members > 0 then
+		for _, member in ipairs(members) do
+			redis.call('ZADD', keys[8], now, member)
+		end
+		redis.call('ZREMRANGEBYSCORE', keys[8], '-inf', now - cooldown)
+		redis.call('PEXPIRE', keys[8], cooldown)
+	end
+	return popped
+end
+
+local function record(popped)
+	local count = #popped / 2
+	if count == 0 then
+		return
+	end
+	redis.call('INCRBY', keys[5], count)
+	redis.call('INCRBY', keys[6], count)
+	if not track then
+		return
+	end
+	chunked('SADD', keys[2], membersOf(popped))
+	for i = 1, #popped, 2 do
+		redis.call('ZADD', keys[3], now, popped[i])
+		redis.call('HSET', keys[4], popped[i], popped[i + 1])
+	end
+	if maxTracked <= 0 then
+		return
+	end
+	local excess = redis.call('ZCARD', keys[3]) - maxTracked
+	if excess > 0 then
+		local oldest = redis.call('ZRANGE', keys[3], 0, excess - 1)
+		redis.call('ZREMRANGEBYRANK', keys[3], 0, excess - 1)
+		chunked('SREM', keys[2], oldest)
+		chunked('HDEL', keys[4], oldest)
+	end
+end
+`
+
+// dequeueScript pops up to ARGV[5] members with a score of at least ARGV[6]
+// from the queue and records them as dequeued. It returns the popped members
+// with their scores.
+var dequeueScript = redis.NewScript(dequeueLua + `
+local popped = take(tonumber(ARGV[5]), ARGV[6])
+record(popped)
+return popped
+`)
+
+// recordScript records the members ARGV[6], ARGV[8]... already removed from
+// the queue, with the scores ARGV[7], ARGV[9]... they had, as dequeued. Their
+// per-member metadata is dropped as well when ARGV[5] is '1'.
+var recordScript = redis.NewScript(dequeueLua + `
+local popped = {}
+for i = 6, #ARGV do
+	table.insert(popped, ARGV[i])
+end
+if ARGV[5] == '1' then
+	forget(membersOf(popped))
+end
+record(popped)
+return #popped / 2
+`)
+
+// dequeueKeys returns the keys expected by dequeueLua for the queue, followed
+// by extra.
+func dequeueKeys(queueID string, extra ...string) []string {
+	return append([]string{
+		fmt.Sprintf(queueKey, queueID),
+		fmt.Sprintf(dequeueKey, queueID),
+		fmt.Sprintf(dequeueHistoryKey, queueID),
+		fmt.Sprintf(dequeuedScoreKey, queueID),
+		fmt.Sprintf(throughputKey, queueID),
+		fmt.Sprintf(totalDequeuedKey, queueID),
+		fmt.Sprintf(enqueuedAtKey, queueID),
+		fmt.Sprintf(cooldownKey, queueID),
+		fmt.Sprintf(updateCountKey, queueID),
+		fmt.Sprintf(attemptsKey, queueID),
+	}, extra...)
+}
+
+// dequeueArgs returns the arguments expected by dequeueLua, followed by
+// extra. When track is false, dequeued items are only counted.
+func (q *Service) dequeueArgs(track bool, extra ...interface{}) []interface{} {
+	flag := "0"
+	if track {
+		flag = "1"
+	}
+	return append([]interface{}{
+		flag,
+		time.Now().UnixMilli(),
+		q.cooldown.Milliseconds(),
+		q.maxDequeueSet,
+	}, extra...)
+}
+
+// dequeueN removes up to n items with a score of at least min from the queue
+// and records them as dequeued, atomically in a single Lua script, so
+// concurrent consumers never receive the same item and no item is removed
+// without being recorded.
+func (q *Service) dequeueN(ctx context.Context, queueID string, n int, min string, track bool) ([]redis.Z, error) {
+	vals, err := dequeueScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(queueID),
+		q.dequeueArgs(track, n, min)...,
+	).
+		Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	popped, err := parseScored(vals)
+	if err != nil || len(popped) == 0 {
+		return nil, err
+	}
+	return popped, nil
+}
+
+// recordDequeued records members just removed from the queue as dequeued:
+// it drops their per-member metadata, adds them to the dequeue set and its
+// history, remembers the score each member had in the queue and updates the
+// dequeue counters of the queue.
+func (q *Service) recordDequeued(ctx context.Context, queueID string, popped []redis.Z) error {
+	return q.record(ctx, queueID, popped, true)
+}
+
+// recordCompleted records members as dequeued like recordDequeued, for
+// members whose per-member metadata was already dropped when a script took
+// them from the queue, so that a member enqueued again in the meantime keeps
+// its own.
+func (q *Service) recordCompleted(ctx context.Context, queueID string, popped []redis.Z) error {
+	return q.record(ctx, queueID, popped, false)
+}
+
+// record runs recordScript for popped, dropping the per-member metadata of
+// the members when forget is true.
+func (q *Service) record(ctx context.Context, queueID string, popped []redis.Z, forget bool) error {
+	flag := "0"
+	if forget {
+		flag = "1"
+	}
+	args := make([]interface{}, 0, 1+2*len(popped))
+	args = append(args, flag)
+	for _, z := range popped {
+		args = append(args, z.Member, formatScore(z.Score))
+	}
+	return recordScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(queueID),
+		q.dequeueArgs(true, args...)...,
+	).
+		Err()
+}
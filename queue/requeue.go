@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// requeuePreservingScoreScript re-adds the member ARGV[1] to the queue in
+// KEYS[1] at the score recorded for it in KEYS[3], recording ARGV[2] as its
+// enqueue time in KEYS[4], and removes it from the dequeue set in KEYS[2]. It
+// returns 0 when no score is recorded.
+var requeuePreservingScoreScript = redis.NewScript(`
+local score = redis.call('HGET', KEYS[3], ARGV[1])
+if not score then
+	return 0
+end
+redis.call('ZADD', KEYS[1], score, ARGV[1])
+redis.call('HSETNX', KEYS[4], ARGV[1], ARGV[2])
+redis.call('SREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+// RequeuePreservingScore puts a dequeued member back into the queue at the
+// score it had when it was dequeued, so deadline-scored members keep their
+// original deadline.
+//
+// The member is also removed from the dequeue set. Both steps happen
+// atomically in a single Lua script.
+//
+// Returns:
+//   - ErrMemberNotFound if no dequeue score is recorded for the member.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) RequeuePreservingScore(ctx context.Context, queueID, memberID string) error {
+	return q.requeueStored(ctx, queueID, q.member(memberID))
+}
+
+// requeueStored implements RequeuePreservingScore for a member as stored in
+// Redis.
+func (q *Service) requeueStored(ctx context.Context, queueID, member string) error {
+	requeued, err := requeuePreservingScoreScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(dequeueKey, queueID),
+			fmt.Sprintf(dequeuedScoreKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		member,
+		time.Now().UnixMilli(),
+	).
+		Int()
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	if requeued == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
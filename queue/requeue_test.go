@@ -0,0 +1,48 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestRequeuePreservingScoreRestoresDeadline(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := q.RequeuePreservingScore(ctx, "jobs", "a"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("RequeuePreservingScore before any dequeue: %v; want ErrMemberNotFound", err)
+	}
+
+	for _, item := range []queue.EnqueueItem{{MemberID: "a", Score: 100}, {MemberID: "b", Score: 200}, {MemberID: "c", Score: 300}} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: item.MemberID, Score: item.Score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+
+	if err := q.RequeuePreservingScore(ctx, "jobs", "b"); err != nil {
+		t.Fatalf("RequeuePreservingScore: %v", err)
+	}
+	members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || !slices.Equal(members, []string{"b", "c"}) {
+		t.Fatalf("queue = %v, %v; want [b c]", members, err)
+	}
+	if score, err := h.Client.ZScore(ctx, "queue:jobs", "b").Result(); err != nil || score != 200 {
+		t.Fatalf("score of b = %v, %v; want 200", score, err)
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "b"); err != nil || dequeued {
+		t.Fatalf("IsDequeued(b) = %v, %v; want false", dequeued, err)
+	}
+
+	if err := q.RequeuePreservingScore(ctx, "jobs", "b"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("second RequeuePreservingScore: %v; want ErrMemberNotFound", err)
+	}
+}
@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reserveScript moves up to ARGV[5] members from the head of the queue to
+// the reservation hash KEYS[11], remembering their scores, and records the
+// lease ARGV[6] in KEYS[12] with the expiry ARGV[7]. It returns the reserved
+// members.
+var reserveScript = redis.NewScript(dequeueLua + `
+local popped = take(tonumber(ARGV[5]), '-inf')
+local members = {}
+if #popped == 0 then
+	return members
+end
+for i = 1, #popped, 2 do
+	redis.call('HSET', KEYS[11], popped[i], popped[i + 1])
+	table.insert(members, popped[i])
+end
+redis.call('ZADD', KEYS[12], ARGV[7], ARGV[6])
+return members
+`)
+
+// commitScript removes the reservation hash KEYS[1] and its lease ARGV[1]
+// from KEYS[2], returning the reserved members and scores as a flat list, or
+// nil if the lease does not exist.
+var commitScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return false
+end
+local reserved = redis.call('HGETALL', KEYS[1])
+redis.call('DEL', KEYS[1])
+return reserved
+`)
+
+// reclaimExpiredLeasesScript puts the members of every lease of KEYS[2] that
+// expired before ARGV[1] back in the queue in KEYS[1] at their reserved score,
+// the reservation hash of a lease being ARGV[2] followed by its ID, recording
+// ARGV[1] as their enqueue time in KEYS[3]. It returns the number of reclaimed
+// members.
+var reclaimExpiredLeasesScript = redis.NewScript(`
+local reclaimed = 0
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1])
+for _, leaseID in ipairs(expired) do
+	local key = ARGV[2] .. leaseID
+	local reserved = redis.call('HGETALL', key)
+	for i = 1, #reserved, 2 do
+		redis.call('ZADD', KEYS[1], reserved[i + 1], reserved[i])
+		redis.call('HSETNX', KEYS[3], reserved[i], ARGV[1])
+		reclaimed = reclaimed + 1
+	end
+	redis.call('DEL', key)
+	redis.call('ZREM', KEYS[2], leaseID)
+end
+return reclaimed
+`)
+
+// Reserve removes up to n items from the head of the queue and reserves them
+// under leaseID for lease. The worker owning leaseID confirms the whole batch
+// with Commit; once the lease has expired, ReclaimExpiredLeases puts the
+// items back in the queue. Reserving again under an active lease ID adds the
+// items to it and resets its expiry, while a reservation of an empty queue
+// creates no lease.
+//
+// The items are moved atomically in a single Lua script. The reservation of
+// a lease is stored under its own key, which shares the hash tag of the queue
+// ID, so with Redis Cluster the queue ID must carry a hash tag, such as
+// "{orders}".
+//
+// Returns:
+//   - A slice of strings containing the reserved item IDs.
+//   - ErrInvalidRequest if leaseID is empty or lease is not positive.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Reserve(ctx context.Context, queueID string, n int, leaseID string, lease time.Duration) ([]string, error) {
+	if leaseID == "" {
+		return []string{}, fmt.Errorf("%w: empty lease ID", ErrInvalidRequest)
+	}
+	if lease <= 0 {
+		return []string{}, fmt.Errorf("%w: lease must be positive, got %v", ErrInvalidRequest, lease)
+	}
+	if n <= 0 {
+		n = 1
+	}
+
+	reserved, err := reserveScript.Run(
+		ctx,
+		q.redisClient,
+		dequeueKeys(
+			queueID,
+			fmt.Sprintf(reservationKey, queueID, leaseID),
+			fmt.Sprintf(reservationsKey, queueID),
+		),
+		q.dequeueArgs(true, n, leaseID, time.Now().Add(lease).UnixMilli())...,
+	).
+		StringSlice()
+	if err != nil {
+		return []string{}, q.queueErr(ctx, queueID, err)
+	}
+	return reserved, nil
+}
+
+// Commit releases the reservation of leaseID and records its items as
+// dequeued. A lease that expired but was not reclaimed yet can still be
+// committed.
+//
+// Returns:
+//   - ErrInvalidRequest if leaseID is empty.
+//   - ErrLeaseNotFound if there is no reservation under leaseID.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Commit(ctx context.Context, queueID, leaseID string) error {
+	if leaseID == "" {
+		return fmt.Errorf("%w: empty lease ID", ErrInvalidRequest)
+	}
+
+	reserved, err := commitScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(reservationKey, queueID, leaseID),
+			fmt.Sprintf(reservationsKey, queueID),
+		},
+		leaseID,
+	).
+		Slice()
+	if errors.Is(err, redis.Nil) {
+		return ErrLeaseNotFound
+	}
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+
+	committed, err := parseScored(reserved)
+	if err != nil || len(committed) == 0 {
+		return err
+	}
+	return q.queueErr(ctx, queueID, q.recordCompleted(ctx, queueID, committed))
+}
+
+// ReclaimExpiredLeases puts the items of every expired reservation back in
+// the queue at the score they had when they were reserved. All reservations
+// are checked atomically in a single Lua script.
+//
+// The script reads the reservation keys without declaring them, which Redis
+// Cluster only tolerates when they live in the same hash slot as the queue:
+// use a queue ID with a hash tag, such as "{orders}", which the reservation
+// keys share.
+//
+// Returns:
+//   - The number of reclaimed items.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ReclaimExpiredLeases(ctx context.Context, queueID string) (int64, error) {
+	reclaimed, err := reclaimExpiredLeasesScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(reservationsKey, queueID),
+			fmt.Sprintf(enqueuedAtKey, queueID),
+		},
+		time.Now().UnixMilli(),
+		fmt.Sprintf(reservationKey, queueID, ""),
+	).
+		Int64()
+	return reclaimed, q.queueErr(ctx, queueID, err)
+}
@@ -0,0 +1,71 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestReserveCommitAndReclaim(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	reserved, err := q.Reserve(ctx, "jobs", 2, "w1", time.Minute)
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if want := []string{"a", "b"}; !slices.Equal(reserved, want) {
+		t.Fatalf("Reserve = %v; want %v", reserved, want)
+	}
+	if err := q.Commit(ctx, "jobs", "w1"); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := q.Commit(ctx, "jobs", "w1"); !errors.Is(err, queue.ErrLeaseNotFound) {
+		t.Fatalf("second Commit = %v; want ErrLeaseNotFound", err)
+	}
+	dequeued, err := q.IsDequeued(ctx, "jobs", "a")
+	if err != nil || !dequeued {
+		t.Fatalf("IsDequeued(a) = %v, %v; want true", dequeued, err)
+	}
+
+	if _, err := q.Reserve(ctx, "jobs", 1, "w2", 50*time.Millisecond); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	reclaimed, err := q.ReclaimExpiredLeases(ctx, "jobs")
+	if err != nil || reclaimed != 1 {
+		t.Fatalf("ReclaimExpiredLeases = %d, %v; want 1", reclaimed, err)
+	}
+	if ok, err := q.Contains(ctx, "jobs", "c"); err != nil || !ok {
+		t.Fatalf("Contains(c) = %v, %v; want true", ok, err)
+	}
+	if err := q.Commit(ctx, "jobs", "w2"); !errors.Is(err, queue.ErrLeaseNotFound) {
+		t.Fatalf("Commit of a reclaimed lease = %v; want ErrLeaseNotFound", err)
+	}
+}
+
+func TestReserveRejectsInvalidLease(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	if _, err := q.Reserve(ctx, "jobs", 1, "", time.Minute); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Fatalf("Reserve with an empty lease ID = %v; want ErrInvalidRequest", err)
+	}
+	if _, err := q.Reserve(ctx, "jobs", 1, "w1", 0); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Fatalf("Reserve with a zero lease = %v; want ErrInvalidRequest", err)
+	}
+	if err := q.Commit(ctx, "jobs", ""); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Fatalf("Commit with an empty lease ID = %v; want ErrInvalidRequest", err)
+	}
+}
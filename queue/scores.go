@@ -0,0 +1,237 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scoreLua is prepended to the Lua scripts reading scores back from Redis. It
+// defines toscore(s), which parses a score reply like tonumber but also
+// accepts the "inf" and "-inf" replies of members with an infinite score,
+// which tonumber does not parse on every platform, and finite(score). Both
+// compare against 1/0 rather than math.huge, which some Lua implementations
+// define as the largest finite number.
+const scoreLua = `
+local inf = 1 / 0
+
+local function toscore(s)
+	if s == 'inf' or s == '+inf' then
+		return inf
+	elseif s == '-inf' then
+		return -inf
+	end
+	return tonumber(s)
+end
+
+local function finite(score)
+	return score == score and score ~= inf and score ~= -inf
+end
+`
+
+// shiftAllScoresScript adds ARGV[1] to the score of every member of the queue
+// in KEYS[1] with a finite score, incrementing their update counts in
+// KEYS[2]. It returns -1 without modifying the queue if any resulting score
+// would not be finite, otherwise the number of shifted members.
+var shiftAllScoresScript = redis.NewScript(scoreLua + `
+local delta = tonumber(ARGV[1])
+local members = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+local shifted = 0
+for i = 2, #members, 2 do
+	local score = toscore(members[i])
+	if finite(score) and not finite(score + delta) then
+		return -1
+	end
+end
+for i = 1, #members, 2 do
+	local score = toscore(members[i + 1])
+	if finite(score) then
+		redis.call('ZADD', KEYS[1], score + delta, members[i])
+		redis.call('HINCRBY', KEYS[2], members[i], 1)
+		shifted = shifted + 1
+	end
+end
+return shifted
+`)
+
+// ShiftAllScores adds delta to the score of every member of the queue, e.g. a
+// negative delta expedites every waiting member. Relative order is preserved.
+//
+// The shift runs in a single Lua script and is rejected as a whole if any
+// resulting score would be NaN or infinite. Members with an infinite score
+// keep it and are not counted as shifted.
+//
+// Returns:
+//   - The number of shifted members.
+//   - ErrInvalidRequest if delta or any resulting score is not finite.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ShiftAllScores(ctx context.Context, queueID string, delta float64) (int64, error) {
+	if math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return 0, ErrInvalidRequest
+	}
+
+	shifted, err := shiftAllScoresScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		delta,
+	).
+		Int64()
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	if shifted < 0 {
+		return 0, ErrInvalidRequest
+	}
+	return shifted, nil
+}
+
+// nudgeScript moves the member ARGV[1] of the queue in KEYS[1] by ARGV[2]
+// ranks (negative towards the front), clamped at the queue ends, by scoring it
+// between its new neighbours, incrementing its update count in KEYS[2]. It
+// returns 1 if the rank of the member changed, 0 if it did not, or -1 if the
+// member is not in the queue.
+var nudgeScript = redis.NewScript(scoreLua + `
+local rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+if not rank then
+	return -1
+end
+local last = redis.call('ZCARD', KEYS[1]) - 1
+local target = rank + tonumber(ARGV[2])
+if target < 0 then
+	target = 0
+elseif target > last then
+	target = last
+end
+if target == rank then
+	return 0
+end
+
+local function scoreAt(r)
+	return toscore(redis.call('ZRANGE', KEYS[1], r, r, 'WITHSCORES')[2])
+end
+
+local score
+if target < rank then
+	local after = scoreAt(target)
+	if target > 0 then
+		score = (scoreAt(target - 1) + after) / 2
+	else
+		score = after - 1
+	end
+else
+	local before = scoreAt(target)
+	if target < last then
+		score = (before + scoreAt(target + 1)) / 2
+	else
+		score = before + 1
+	end
+end
+redis.call('ZADD', KEYS[1], score, ARGV[1])
+redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+if redis.call('ZRANK', KEYS[1], ARGV[1]) == rank then
+	return 0
+end
+return 1
+`)
+
+// Nudge moves a member positions ranks towards the back of the queue, or
+// towards the front when positions is negative, clamping at the queue ends.
+//
+// The new score is the midpoint between the scores of the new neighbours, or
+// one past the head or tail score at the queue ends, computed atomically in a
+// single Lua script. When the new neighbours share the same score, the member
+// ends up among them in lexical order, so it may not move at all.
+//
+// Returns:
+//   - true if the rank of the member changed; false if it is already at the
+//     queue end it is nudged towards, positions is 0, or its neighbours' scores
+//     leave no room to move it.
+//   - ErrMemberNotFound if the member is not in the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Nudge(ctx context.Context, queueID, memberID string, positions int) (bool, error) {
+	nudged, err := nudgeScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		q.member(memberID),
+		positions,
+	).
+		Int()
+	if err != nil {
+		return false, q.queueErr(ctx, queueID, err)
+	}
+	if nudged < 0 {
+		return false, ErrMemberNotFound
+	}
+	return nudged == 1, nil
+}
+
+// scaleScoresScript multiplies the score of every member of the queue in
+// KEYS[1] with a finite score by ARGV[1], incrementing their update counts in
+// KEYS[2]. It returns -1 without modifying the queue if any resulting score
+// would not be finite, otherwise the number of scaled members.
+var scaleScoresScript = redis.NewScript(scoreLua + `
+local factor = tonumber(ARGV[1])
+local members = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+local scaled = 0
+for i = 2, #members, 2 do
+	local score = toscore(members[i])
+	if finite(score) and not finite(score * factor) then
+		return -1
+	end
+end
+for i = 1, #members, 2 do
+	local score = toscore(members[i + 1])
+	if finite(score) then
+		redis.call('ZADD', KEYS[1], score * factor, members[i])
+		redis.call('HINCRBY', KEYS[2], members[i], 1)
+		scaled = scaled + 1
+	end
+end
+return scaled
+`)
+
+// ScaleScores multiplies the score of every member of the queue by factor,
+// e.g. to convert scores from seconds to milliseconds. Relative order is
+// preserved, except between members whose scores become equal once rounded
+// to the float64 precision.
+//
+// The scaling runs in a single Lua script and is rejected as a whole if any
+// resulting score would be infinite. Members with an infinite score keep it.
+//
+// Returns:
+//   - ErrInvalidRequest if factor is not positive and finite, or if any
+//     resulting score is not finite.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ScaleScores(ctx context.Context, queueID string, factor float64) error {
+	if !(factor > 0) || math.IsInf(factor, 0) {
+		return fmt.Errorf("%w: scale factor must be positive and finite, got %v", ErrInvalidRequest, factor)
+	}
+
+	scaled, err := scaleScoresScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(updateCountKey, queueID),
+		},
+		factor,
+	).
+		Int64()
+	if err != nil {
+		return q.queueErr(ctx, queueID, err)
+	}
+	if scaled < 0 {
+		return ErrInvalidRequest
+	}
+	return nil
+}
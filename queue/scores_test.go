@@ -0,0 +1,118 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNudgeReportsRankChange(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for _, id := range []string{"x", "y", "z"} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "ties", MemberID: id, Score: 5}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	tests := []struct {
+		queueID   string
+		member    string
+		positions int
+		want      bool
+	}{
+		{"jobs", "c", -1, true},
+		{"jobs", "a", -1, false},
+		{"jobs", "a", 0, false},
+		// The midpoint of tied neighbours is their score, so z stays last.
+		{"ties", "z", -1, false},
+	}
+	for _, tt := range tests {
+		moved, err := q.Nudge(ctx, tt.queueID, tt.member, tt.positions)
+		if err != nil || moved != tt.want {
+			t.Errorf("Nudge(%s, %s, %d) = %v, %v; want %v", tt.queueID, tt.member, tt.positions, moved, err, tt.want)
+		}
+	}
+
+	order, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("ZRange: %v", err)
+	}
+	if want := []string{"a", "c", "b"}; !slices.Equal(order, want) {
+		t.Fatalf("order = %v; want %v", order, want)
+	}
+}
+
+func TestShiftAllScoresKeepsInfiniteScores(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+
+	if err := h.Client.ZAdd(ctx, "queue:jobs",
+		redis.Z{Score: math.Inf(-1), Member: "first"},
+		redis.Z{Score: 1, Member: "a"},
+		redis.Z{Score: math.Inf(1), Member: "last"},
+	).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	shifted, err := h.Service.ShiftAllScores(ctx, "jobs", 10)
+	if err != nil || shifted != 1 {
+		t.Fatalf("ShiftAllScores = %d, %v; want 1, nil", shifted, err)
+	}
+
+	want := map[string]float64{"first": math.Inf(-1), "a": 11, "last": math.Inf(1)}
+	for member, score := range want {
+		got, err := h.Client.ZScore(ctx, "queue:jobs", member).Result()
+		if err != nil || got != score {
+			t.Errorf("score of %s = %v, %v; want %v", member, got, err, score)
+		}
+	}
+}
+
+func TestScaleScores(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := h.Client.ZAdd(ctx, "queue:jobs",
+		redis.Z{Score: 1.5, Member: "a"},
+		redis.Z{Score: 3, Member: "b"},
+		redis.Z{Score: -2, Member: "c"},
+		redis.Z{Score: math.Inf(1), Member: "last"},
+	).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	if err := q.ScaleScores(ctx, "jobs", 1000); err != nil {
+		t.Fatalf("ScaleScores: %v", err)
+	}
+	want := []redis.Z{{Score: -2000, Member: "c"}, {Score: 1500, Member: "a"}, {Score: 3000, Member: "b"}, {Score: math.Inf(1), Member: "last"}}
+	got, err := h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("queue = %v, %v; want %v", got, err, want)
+	}
+
+	for _, factor := range []float64{0, -1, math.Inf(1), math.NaN()} {
+		if err := q.ScaleScores(ctx, "jobs", factor); !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("ScaleScores(%v): %v; want ErrInvalidRequest", factor, err)
+		}
+	}
+	// A rejected scaling leaves every score untouched.
+	got, err = h.Client.ZRangeWithScores(ctx, "queue:jobs", 0, -1).Result()
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("queue after rejected scalings = %v, %v; want %v", got, err, want)
+	}
+}
@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// SecondarySortScale is the composite score distance between two
+	// consecutive primary scores of an item enqueued with a secondary sort
+	// key: the secondary key takes the low 32 bits of the composite score.
+	SecondarySortScale = 1 << 32
+
+	// MaxSecondaryPrimary bounds the absolute primary score of an item
+	// enqueued with a secondary sort key, so that the composite score, which
+	// takes 52 bits, is exactly representable as a float64.
+	MaxSecondaryPrimary = 1<<20 - 1
+)
+
+// compositeScore returns the score stored for in: its score, or the composite
+// of its score and secondary sort key when EnqueueReq.SecondarySort is set.
+//
+// The caller-provided score is checked with the WithScoreValidator validator
+// before it is combined.
+func (q *Service) compositeScore(in *EnqueueReq) (float64, error) {
+	if err := q.validateScore(in.Score); err != nil {
+		return 0, err
+	}
+	if in.SecondarySort == nil {
+		return in.Score, nil
+	}
+
+	primary, secondary := in.Score, *in.SecondarySort
+	if primary != math.Trunc(primary) || math.Abs(primary) > MaxSecondaryPrimary {
+		return 0, fmt.Errorf("%w: primary score %v must be an integer within ±%d", ErrInvalidRequest, primary, MaxSecondaryPrimary)
+	}
+	if secondary != math.Trunc(secondary) || secondary < 0 || secondary >= SecondarySortScale {
+		return 0, fmt.Errorf("%w: secondary sort key %v must be an integer within [0, 2^32)", ErrInvalidRequest, secondary)
+	}
+	return primary*SecondarySortScale + secondary, nil
+}
+
+// GetPrimaryScore returns the primary score encoded in a composite score of an
+// item enqueued with EnqueueReq.SecondarySort.
+func GetPrimaryScore(score float64) float64 {
+	return math.Floor(score / SecondarySortScale)
+}
+
+// GetSecondarySort returns the secondary sort key encoded in a composite score
+// of an item enqueued with EnqueueReq.SecondarySort.
+func GetSecondarySort(score float64) float64 {
+	return score - GetPrimaryScore(score)*SecondarySortScale
+}
@@ -0,0 +1,72 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestSecondarySortOrdersWithinPrimary(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	items := []struct {
+		member             string
+		primary, secondary float64
+	}{
+		{"p1-late", 1, 900},
+		{"p1-early", 1, 5},
+		{"p0", 0, 1<<32 - 1},
+		{"urgent", -3, 7},
+		{"p2", 2, 0},
+	}
+	for _, item := range items {
+		secondary := item.secondary
+		req := &queue.EnqueueReq{ID: "jobs", MemberID: item.member, Score: item.primary, SecondarySort: &secondary}
+		if err := q.Enqueue(ctx, req); err != nil {
+			t.Fatalf("Enqueue(%s): %v", item.member, err)
+		}
+	}
+
+	members, err := h.Client.ZRange(ctx, "queue:jobs", 0, -1).Result()
+	if want := []string{"urgent", "p0", "p1-early", "p1-late", "p2"}; err != nil || !slices.Equal(members, want) {
+		t.Fatalf("queue = %v, %v; want %v", members, err, want)
+	}
+	for _, item := range items {
+		score, err := h.Client.ZScore(ctx, "queue:jobs", item.member).Result()
+		if err != nil {
+			t.Fatalf("ZScore(%s): %v", item.member, err)
+		}
+		if primary, secondary := queue.GetPrimaryScore(score), queue.GetSecondarySort(score); primary != item.primary || secondary != item.secondary {
+			t.Errorf("decoded score of %s = %v, %v; want %v, %v", item.member, primary, secondary, item.primary, item.secondary)
+		}
+	}
+}
+
+func TestSecondarySortRejectsOutOfRange(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	tests := []struct {
+		name               string
+		primary, secondary float64
+	}{
+		{"fractional primary", 1.5, 0},
+		{"primary too large", queue.MaxSecondaryPrimary + 1, 0},
+		{"negative secondary", 1, -1},
+		{"secondary too large", 1, queue.SecondarySortScale},
+		{"fractional secondary", 1, 0.5},
+	}
+	for _, tt := range tests {
+		secondary := tt.secondary
+		err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a", Score: tt.primary, SecondarySort: &secondary})
+		if !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("Enqueue with a %s: %v; want ErrInvalidRequest", tt.name, err)
+		}
+	}
+}
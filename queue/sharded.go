@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dequeueShardedScript pops up to ARGV[5] members across the ARGV[6] shard
+// queues, whose dequeueKeys follow each other in KEYS, each time from the
+// shard with the most urgent head, and records each member as dequeued from
+// its shard. It returns a flat member, score, shard index (0-based) list.
+var dequeueShardedScript = redis.NewScript(dequeueLua + scoreLua + `
+local n = tonumber(ARGV[5])
+local shards = tonumber(ARGV[6])
+local stride = #KEYS / shards
+local popped = {}
+for _ = 1, n do
+	local best, bestScore = nil, nil
+	for i = 1, shards do
+		local head = redis.call('ZRANGE', KEYS[(i - 1) * stride + 1], 0, 0, 'WITHSCORES')
+		if #head > 0 and (bestScore == nil or toscore(head[2]) < bestScore) then
+			best, bestScore = i, toscore(head[2])
+		end
+	end
+	if best == nil then
+		break
+	end
+	keys = {unpack(KEYS, (best - 1) * stride + 1, best * stride)}
+	local head = take(1, '-inf')
+	record(head)
+	table.insert(popped, head[1])
+	table.insert(popped, head[2])
+	table.insert(popped, best - 1)
+end
+return popped
+`)
+
+// ShardQueueID returns the queue ID of the given shard of a sharded queue, as
+// used by DequeueSharded. Producers enqueue into these queue IDs.
+func ShardQueueID(baseQueueID string, shard int) string {
+	return fmt.Sprintf("%s:%d", baseQueueID, shard)
+}
+
+// DequeueSharded removes up to n items from a logical queue split across
+// shards sub-queues (see ShardQueueID), each time taking the head of the shard
+// with the most urgent head.
+//
+// The shard selection, the removal and the recording of each item as dequeued
+// from its shard happen atomically in a single Lua script.
+//
+// Returns:
+//   - A slice of strings containing the dequeued item IDs in dequeue order.
+//   - ErrInvalidRequest if shards is not positive or the Service is created
+//     with WithDequeueCooldown.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DequeueSharded(ctx context.Context, baseQueueID string, shards int, n int) ([]string, error) {
+	if shards <= 0 {
+		return []string{}, ErrInvalidRequest
+	}
+	if err := q.rejectCooldown("DequeueSharded"); err != nil {
+		return []string{}, err
+	}
+	if n <= 0 {
+		n = 1
+	}
+
+	queueIDs := make([]string, 0, shards)
+	keys := []string{}
+	for i := 0; i < shards; i++ {
+		queueIDs = append(queueIDs, ShardQueueID(baseQueueID, i))
+		keys = append(keys, dequeueKeys(queueIDs[i])...)
+	}
+
+	vals, err := dequeueShardedScript.Run(
+		ctx,
+		q.redisClient,
+		keys,
+		q.dequeueArgs(true, n, shards)...,
+	).
+		Slice()
+	if err != nil {
+		return []string{}, q.queuesErr(ctx, err, queueIDs...)
+	}
+
+	members := make([]string, 0, len(vals)/3)
+	for i := 0; i+2 < len(vals); i += 3 {
+		member, _ := vals[i].(string)
+		members = append(members, member)
+	}
+	return members, nil
+}
@@ -0,0 +1,76 @@
+package queue_test
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestDequeueShardedOrdersInfiniteHeads(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+
+	heads := []redis.Z{
+		{Score: 0, Member: "zero"},
+		{Score: math.Inf(1), Member: "last"},
+		{Score: math.Inf(-1), Member: "first"},
+	}
+	for i, z := range heads {
+		if err := h.Client.ZAdd(ctx, "queue:"+queue.ShardQueueID("jobs", i), z).Err(); err != nil {
+			t.Fatalf("ZAdd: %v", err)
+		}
+	}
+
+	members, err := h.Service.DequeueSharded(ctx, "jobs", len(heads), len(heads))
+	if err != nil {
+		t.Fatalf("DequeueSharded: %v", err)
+	}
+	if want := []string{"first", "zero", "last"}; !slices.Equal(members, want) {
+		t.Fatalf("DequeueSharded = %v; want %v", members, want)
+	}
+}
+
+func TestDequeueShardedPicksMostUrgentShard(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	shards := []map[string]float64{
+		{"a": 1, "d": 4},
+		{"b": 2},
+		{"c": 3, "e": 5},
+	}
+	for i, members := range shards {
+		for id, score := range members {
+			if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: queue.ShardQueueID("jobs", i), MemberID: id, Score: score}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+		}
+	}
+
+	for _, want := range [][]string{{"a", "b", "c", "d"}, {"e"}, {}} {
+		members, err := q.DequeueSharded(ctx, "jobs", len(shards), 4)
+		if err != nil {
+			t.Fatalf("DequeueSharded: %v", err)
+		}
+		if !slices.Equal(members, want) {
+			t.Fatalf("DequeueSharded = %v; want %v", members, want)
+		}
+	}
+
+	for i, members := range shards {
+		shardID := queue.ShardQueueID("jobs", i)
+		for id := range members {
+			if dequeued, err := q.IsDequeued(ctx, shardID, id); err != nil || !dequeued {
+				t.Errorf("IsDequeued(%s, %s) = %v, %v; want true", shardID, id, dequeued, err)
+			}
+		}
+		if total, err := q.LifetimeDequeued(ctx, shardID); err != nil || total != int64(len(members)) {
+			t.Errorf("LifetimeDequeued(%s) = %d, %v; want %d", shardID, total, err, len(members))
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// snapshotViewScript returns the length of the queue in KEYS[1] followed by
+// all its members and scores.
+var snapshotViewScript = redis.NewScript(`
+local members = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+return {redis.call('ZCARD', KEYS[1]), members}
+`)
+
+// SnapshotView returns every member of the queue with its score, together with
+// the queue length, read in a single Lua script so that both always agree.
+//
+// The whole queue is loaded in memory on both Redis and the client, so avoid
+// calling it on very large queues.
+//
+// Returns:
+//   - A map of members to their scores.
+//   - The length of the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) SnapshotView(ctx context.Context, queueID string) (map[string]float64, int64, error) {
+	vals, err := snapshotViewScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(queueKey, queueID)},
+	).
+		Slice()
+	if err != nil {
+		return nil, 0, q.queueErr(ctx, queueID, err)
+	}
+	if len(vals) != 2 {
+		return nil, 0, fmt.Errorf("unexpected snapshot reply length %d", len(vals))
+	}
+
+	length, ok := vals[0].(int64)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected length type %T", vals[0])
+	}
+	flat, ok := vals[1].([]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected members type %T", vals[1])
+	}
+	members, err := parseScored(flat)
+	if err != nil {
+		return nil, 0, q.queueErr(ctx, queueID, err)
+	}
+
+	view := make(map[string]float64, len(members))
+	for _, z := range members {
+		view[z.Member.(string)] = z.Score
+	}
+	return view, length, nil
+}
+
+// PreviewScoreRange returns the members of the queue whose score is within
+// [min, max], in score order, without modifying the queue. It previews what a
+// removal by the same score range would delete; use math.Inf for open bounds.
+//
+// Returns:
+//   - A slice of Member in score order.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) PreviewScoreRange(ctx context.Context, queueID string, min, max float64) ([]Member, error) {
+	members, err := q.reader().
+		ZRangeByScoreWithScores(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			&redis.ZRangeBy{
+				Min: formatScore(min),
+				Max: formatScore(max),
+			},
+		).
+		Result()
+	if err != nil {
+		return []Member{}, q.queueErr(ctx, queueID, err)
+	}
+	return toMembers(members), nil
+}
+
+// Checksum returns a deterministic hex encoded SHA-256 digest of the queue
+// content: every member and its score, in priority order. Two queues with the
+// same members and scores have the same checksum, which makes it suitable for
+// replication checks.
+//
+// The queue is read with a single ZRANGE, so the digest reflects one
+// consistent state of the queue.
+//
+// Returns:
+//   - The checksum of the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Checksum(ctx context.Context, queueID string) (string, error) {
+	members, err := q.reader().
+		ZRangeWithScores(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			0,
+			-1,
+		).
+		Result()
+	if err != nil {
+		return "", q.queueErr(ctx, queueID, err)
+	}
+
+	h := sha256.New()
+	for _, z := range members {
+		fmt.Fprintf(h, "%s\x00%s\n", z.Member, strconv.FormatFloat(z.Score, 'g', -1, 64))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// snapshotEntry is the JSON representation of a member used by SnapshotJSON.
+type snapshotEntry struct {
+	ID       string  `json:"id"`
+	Score    float64 `json:"score"`
+	Position int64   `json:"position"`
+}
+
+// SnapshotJSON returns the queue as a JSON array of its members in dequeue
+// order, e.g. [{"id":"a","score":1,"position":0}], ready to be served by an
+// API endpoint. An empty queue gives [].
+//
+// It is WriteSnapshotJSON into memory; use WriteSnapshotJSON to stream large
+// queues instead.
+//
+// Returns:
+//   - The JSON encoded queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) SnapshotJSON(ctx context.Context, queueID string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := q.WriteSnapshotJSON(ctx, queueID, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteSnapshotJSON writes the queue to w as a JSON array of its members in
+// dequeue order, in the format of SnapshotJSON.
+//
+// The queue is read, encoded and written in pages, so neither the queue nor
+// its encoding is ever held in memory as a whole, but members moved during
+// the walk may be missed or reported twice. Infinite scores cannot be
+// represented in JSON and make it fail. On failure, w may have received an
+// incomplete array.
+//
+// Returns:
+//   - An error if the operation or a write to w fails; otherwise, nil.
+func (q *Service) WriteSnapshotJSON(ctx context.Context, queueID string, w io.Writer) error {
+	const pageSize = 100
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for position := int64(0); ; {
+		members, err := q.reader().
+			ZRangeWithScores(
+				ctx,
+				fmt.Sprintf(queueKey, queueID),
+				position,
+				position+pageSize-1,
+			).
+			Result()
+		if err != nil {
+			return q.queueErr(ctx, queueID, err)
+		}
+
+		for _, z := range members {
+			entry, err := json.Marshal(snapshotEntry{
+				ID:       z.Member.(string),
+				Score:    z.Score,
+				Position: position,
+			})
+			if err != nil {
+				return err
+			}
+			if position > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(entry)
+			position++
+		}
+
+		if len(members) < pageSize {
+			break
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// cursorByScoreScript returns up to ARGV[3] members of the queue in KEYS[1]
+// with their scores, in dequeue order, starting right after the member ARGV[2]
+// with score ARGV[1]: first the members tied at ARGV[1] that sort after
+// ARGV[2], then the members with a greater score.
+var cursorByScoreScript = redis.NewScript(`
+local limit = tonumber(ARGV[3])
+local page = {}
+local offset = 0
+while #page < 2 * limit do
+	local ties = redis.call('ZRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1], 'WITHSCORES', 'LIMIT', offset, 100)
+	if #ties == 0 then
+		break
+	end
+	for i = 1, #ties, 2 do
+		if #page < 2 * limit and ties[i] > ARGV[2] then
+			table.insert(page, ties[i])
+			table.insert(page, ties[i + 1])
+		end
+	end
+	offset = offset + 100
+end
+local missing = limit - #page / 2
+if missing > 0 then
+	local rest = redis.call('ZRANGEBYSCORE', KEYS[1], '(' .. ARGV[1], '+inf', 'WITHSCORES', 'LIMIT', 0, missing)
+	for _, v in ipairs(rest) do
+		table.insert(page, v)
+	end
+end
+return page
+`)
+
+// CursorByScore returns up to limit members of the queue with their scores, in
+// dequeue order, starting right after the (afterScore, afterMember) cursor,
+// together with the cursor of the next page. Start with math.Inf(-1) and an
+// empty member; a page shorter than limit is the last one.
+//
+// Pages are keyed by score and member rather than by rank, so members removed
+// from the head between two calls do not shift the remaining ones: no member
+// still in the queue is skipped or returned twice, unless it is rescored.
+//
+// Returns:
+//   - The members of the page in dequeue order.
+//   - The score and member to pass to get the next page, unchanged if the
+//     page is empty.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) CursorByScore(ctx context.Context, queueID string, afterScore float64, afterMember string, limit int64) ([]Member, float64, string, error) {
+	if limit <= 0 {
+		return []Member{}, afterScore, afterMember, nil
+	}
+
+	vals, err := cursorByScoreScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(queueKey, queueID)},
+		formatScore(afterScore),
+		afterMember,
+		limit,
+	).
+		Slice()
+	if err != nil {
+		return []Member{}, afterScore, afterMember, q.queueErr(ctx, queueID, err)
+	}
+
+	page, err := parseScored(vals)
+	if err != nil {
+		return []Member{}, afterScore, afterMember, err
+	}
+	if len(page) == 0 {
+		return []Member{}, afterScore, afterMember, nil
+	}
+	last := page[len(page)-1]
+	return toMembers(page), last.Score, last.Member.(string), nil
+}
@@ -0,0 +1,248 @@
+package queue_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+// pageWriter records every write it receives, failing once failAt writes were
+// made if failAt is positive.
+type pageWriter struct {
+	bytes.Buffer
+	writes int
+	failAt int
+}
+
+var errWrite = errors.New("write failed")
+
+func (w *pageWriter) Write(p []byte) (int, error) {
+	if w.failAt > 0 && w.writes == w.failAt {
+		return 0, errWrite
+	}
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestWriteSnapshotJSON(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	var w pageWriter
+	if err := q.WriteSnapshotJSON(ctx, "jobs", &w); err != nil {
+		t.Fatalf("WriteSnapshotJSON on empty queue: %v", err)
+	}
+	if got := w.String(); got != "[]" {
+		t.Fatalf("empty snapshot = %s; want []", got)
+	}
+
+	const n = 250
+	for i := 0; i < n; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%03d", i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	w = pageWriter{}
+	if err := q.WriteSnapshotJSON(ctx, "jobs", &w); err != nil {
+		t.Fatalf("WriteSnapshotJSON: %v", err)
+	}
+	if w.writes != 3 {
+		t.Errorf("writes = %d; want one per page", w.writes)
+	}
+
+	var entries []struct {
+		ID       string  `json:"id"`
+		Score    float64 `json:"score"`
+		Position int64   `json:"position"`
+	}
+	if err := json.Unmarshal(w.Bytes(), &entries); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(entries) != n {
+		t.Fatalf("len(entries) = %d; want %d", len(entries), n)
+	}
+	for i, e := range entries {
+		if e.ID != fmt.Sprintf("m%03d", i) || e.Score != float64(i) || e.Position != int64(i) {
+			t.Fatalf("entries[%d] = %+v", i, e)
+		}
+	}
+
+	snapshot, err := q.SnapshotJSON(ctx, "jobs")
+	if err != nil || !bytes.Equal(snapshot, w.Bytes()) {
+		t.Fatalf("SnapshotJSON = %d bytes, %v; want the WriteSnapshotJSON output", len(snapshot), err)
+	}
+
+	w = pageWriter{failAt: 1}
+	if err := q.WriteSnapshotJSON(ctx, "jobs", &w); !errors.Is(err, errWrite) {
+		t.Fatalf("WriteSnapshotJSON with failing writer: %v; want %v", err, errWrite)
+	}
+}
+
+func TestSnapshotViewConsistentWithWriters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, _ := queuetest.NewTestService(t)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ctx.Err() == nil; i++ {
+				id := fmt.Sprintf("w%d-%d", w, i%20)
+				if i%3 == 2 {
+					_ = q.Delete(ctx, &queue.DeleteReq{ID: "jobs", MemberID: id})
+					continue
+				}
+				_ = q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i)})
+			}
+		}(w)
+	}
+
+	for i := 0; i < 200; i++ {
+		view, length, err := q.SnapshotView(ctx, "jobs")
+		if err != nil {
+			t.Fatalf("SnapshotView: %v", err)
+		}
+		if int64(len(view)) != length {
+			t.Fatalf("SnapshotView returned %d members for a length of %d", len(view), length)
+		}
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestPreviewScoreRangeLeavesQueueIntact(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for i, score := range []float64{1, 2, 3, 4, 5} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%d", i), Score: score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	tests := []struct {
+		min, max float64
+		want     []queue.Member
+	}{
+		{2, 4, []queue.Member{{MemberID: "m1", Score: 2}, {MemberID: "m2", Score: 3}, {MemberID: "m3", Score: 4}}},
+		{math.Inf(-1), 1, []queue.Member{{MemberID: "m0", Score: 1}}},
+		{5, math.Inf(1), []queue.Member{{MemberID: "m4", Score: 5}}},
+		{6, 9, []queue.Member{}},
+	}
+	for _, tt := range tests {
+		got, err := q.PreviewScoreRange(ctx, "jobs", tt.min, tt.max)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("PreviewScoreRange(%v, %v) = %v, %v; want %v", tt.min, tt.max, got, err, tt.want)
+		}
+	}
+
+	if waiting, _, err := q.Progress(ctx, "jobs"); err != nil || waiting != 5 {
+		t.Fatalf("queue length after previews = %d, %v; want 5", waiting, err)
+	}
+}
+
+func TestChecksumMatchesEqualContent(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	items := []queue.EnqueueItem{{MemberID: "a", Score: 1}, {MemberID: "b", Score: 2.5}, {MemberID: "c", Score: 3}}
+	for i := range items {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "primary", MemberID: items[i].MemberID, Score: items[i].Score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+		// The copy is filled in reverse order.
+		item := items[len(items)-1-i]
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "copy", MemberID: item.MemberID, Score: item.Score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	checksum := func(queueID string) string {
+		t.Helper()
+		sum, err := q.Checksum(ctx, queueID)
+		if err != nil {
+			t.Fatalf("Checksum(%s): %v", queueID, err)
+		}
+		return sum
+	}
+	primary := checksum("primary")
+	if got := checksum("copy"); got != primary {
+		t.Fatalf("Checksum of an equal queue = %s; want %s", got, primary)
+	}
+	if got := checksum("primary"); got != primary {
+		t.Fatalf("Checksum is not deterministic: %s then %s", primary, got)
+	}
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "copy", MemberID: "b", Score: 2.25}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if got := checksum("copy"); got == primary {
+		t.Fatalf("Checksum after a score change = %s; want it to differ", got)
+	}
+	if checksum("empty") == primary {
+		t.Fatalf("Checksum of an empty queue equals a populated one")
+	}
+}
+
+func TestCursorByScoreSurvivesHeadRemovals(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("m%d", i)
+		want = append(want, id)
+		// Pairs of members share a score, so the cursor must break ties.
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64(i / 2)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	var (
+		got         []string
+		afterScore  = math.Inf(-1)
+		afterMember string
+	)
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("CursorByScore did not reach the end, got %v", got)
+		}
+		page, nextScore, nextMember, err := q.CursorByScore(ctx, "jobs", afterScore, afterMember, 3)
+		if err != nil {
+			t.Fatalf("CursorByScore: %v", err)
+		}
+		for _, m := range page {
+			got = append(got, m.MemberID)
+		}
+		afterScore, afterMember = nextScore, nextMember
+		if len(page) < 3 {
+			break
+		}
+
+		// Consumers drain the head between pages.
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2}); err != nil {
+			t.Fatalf("Dequeue: %v", err)
+		}
+	}
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("CursorByScore pages = %v; want %v", got, want)
+	}
+
+	page, nextScore, nextMember, err := q.CursorByScore(ctx, "jobs", afterScore, afterMember, 3)
+	if err != nil || len(page) != 0 || nextScore != afterScore || nextMember != afterMember {
+		t.Fatalf("CursorByScore past the end = %v, %v, %q, %v; want an empty page and the same cursor", page, nextScore, nextMember, err)
+	}
+}
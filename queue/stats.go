@@ -0,0 +1,396 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Progress returns how many items are still waiting in the queue and how many
+// have been dequeued from it, read in a single pipeline.
+//
+// The dequeued count is the size of the dequeue set, so it is only meaningful
+// for items consumed through the tracked dequeue paths. An untouched queue
+// reports zero for both.
+//
+// Returns:
+//   - The number of waiting items.
+//   - The number of dequeued items.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Progress(ctx context.Context, queueID string) (int64, int64, error) {
+	pipe := q.reader().Pipeline()
+	waiting := pipe.ZCard(ctx, fmt.Sprintf(queueKey, queueID))
+	dequeued := pipe.SCard(ctx, fmt.Sprintf(dequeueKey, queueID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, q.queueErr(ctx, queueID, err)
+	}
+
+	return waiting.Val(), dequeued.Val(), nil
+}
+
+// Throughput returns the cumulative number of items dequeued from the queue.
+//
+// The counter only ever grows, so callers diff successive readings to get a
+// dequeue rate. Use ResetThroughput to start counting from zero again.
+//
+// Returns:
+//   - The number of items dequeued since the counter was last reset.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Throughput(ctx context.Context, queueID string) (int64, error) {
+	total, err := q.reader().
+		Get(
+			ctx,
+			fmt.Sprintf(throughputKey, queueID),
+		).
+		Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return total, err
+}
+
+// LifetimeDequeued returns the number of items ever dequeued from the queue.
+//
+// Dequeue increments the count in the same Lua script that removes the
+// items, so a crash never loses part of it. Unlike Throughput, it is only
+// reset by DeleteQueue, and unlike Progress, it does not depend on the
+// dequeue set, so it survives WithMaxDequeueSet trimming. It suits billing
+// and other cumulative metrics.
+//
+// Returns:
+//   - The number of items ever dequeued from the queue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) LifetimeDequeued(ctx context.Context, queueID string) (int64, error) {
+	total, err := q.reader().
+		Get(
+			ctx,
+			fmt.Sprintf(totalDequeuedKey, queueID),
+		).
+		Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return total, err
+}
+
+// ResetThroughput resets the cumulative dequeued count of the queue to zero.
+//
+// Returns:
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ResetThroughput(ctx context.Context, queueID string) error {
+	return q.redisClient.
+		Del(
+			ctx,
+			fmt.Sprintf(throughputKey, queueID),
+		).
+		Err()
+}
+
+// QueueOverview represents the depth and head of a queue.
+type QueueOverview struct {
+	// Length is the number of items in the queue.
+	Length int64
+
+	// Head is the member at the front of the queue, empty if the queue is empty.
+	Head string
+
+	// HeadScore is the score of the head member.
+	HeadScore float64
+}
+
+// Overview returns the length and head of every given queue using a single
+// pipeline. Empty queues get a zero Length and an empty Head.
+//
+// Returns:
+//   - A map of queue IDs to their overview.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Overview(ctx context.Context, queueIDs []string) (map[string]QueueOverview, error) {
+	pipe := q.reader().Pipeline()
+	lengths := make([]*redis.IntCmd, 0, len(queueIDs))
+	heads := make([]*redis.ZSliceCmd, 0, len(queueIDs))
+	for _, queueID := range queueIDs {
+		key := fmt.Sprintf(queueKey, queueID)
+		lengths = append(lengths, pipe.ZCard(ctx, key))
+		heads = append(heads, pipe.ZRangeWithScores(ctx, key, 0, 0))
+	}
+	if len(queueIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	overview := make(map[string]QueueOverview, len(queueIDs))
+	for i, queueID := range queueIDs {
+		o := QueueOverview{Length: lengths[i].Val()}
+		if head := heads[i].Val(); len(head) > 0 {
+			o.Head = head[0].Member.(string)
+			o.HeadScore = head[0].Score
+		}
+		overview[queueID] = o
+	}
+	return overview, nil
+}
+
+// DequeueSizeStats returns statistics about the number of items removed by
+// each non-empty Dequeue call on the queue, to help tune DequeueReq.Number.
+//
+// Returns:
+//   - The number of recorded dequeues.
+//   - The average number of items per dequeue.
+//   - The largest number of items removed by a single dequeue.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DequeueSizeStats(ctx context.Context, queueID string) (int64, float64, int64, error) {
+	vals, err := q.reader().
+		HMGet(
+			ctx,
+			fmt.Sprintf(dequeueStatsKey, queueID),
+			"count", "total", "max",
+		).
+		Result()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	stats := make([]int64, len(vals))
+	for i, v := range vals {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if stats[i], err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	count, total, max := stats[0], stats[1], stats[2]
+	if count == 0 {
+		return 0, 0, 0, nil
+	}
+	return count, float64(total) / float64(count), max, nil
+}
+
+// TotalDequeued returns the total size of the dequeue sets of the given
+// queues, read in a single pipeline. Queues without a dequeue set count as
+// zero.
+//
+// Returns:
+//   - The number of dequeued items across all queues.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) TotalDequeued(ctx context.Context, queueIDs []string) (int64, error) {
+	if len(queueIDs) == 0 {
+		return 0, nil
+	}
+
+	pipe := q.reader().Pipeline()
+	counts := make([]*redis.IntCmd, 0, len(queueIDs))
+	for _, queueID := range queueIDs {
+		counts = append(counts, pipe.SCard(ctx, fmt.Sprintf(dequeueKey, queueID)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, count := range counts {
+		total += count.Val()
+	}
+	return total, nil
+}
+
+// scoreCountsScript counts the members of the queue in KEYS[1] in the buckets
+// delimited by the ascending edges in ARGV: (-inf, ARGV[1]), [ARGV[1], ARGV[2]),
+// ..., [ARGV[n], +inf).
+var scoreCountsScript = redis.NewScript(`
+local counts = {}
+for i = 0, #ARGV do
+	local min = '-inf'
+	if i > 0 then
+		min = ARGV[i]
+	end
+	local max = '+inf'
+	if i < #ARGV then
+		max = '(' .. ARGV[i + 1]
+	end
+	table.insert(counts, redis.call('ZCOUNT', KEYS[1], min, max))
+end
+return counts
+`)
+
+// ScoreCountsAtomic returns a histogram of the queue scores over the buckets
+// delimited by edges: (-inf, edges[0]), [edges[0], edges[1]), ...,
+// [edges[n-1], +inf). The len(edges)+1 counts therefore always add up to the
+// queue length.
+//
+// All counts are computed in a single Lua script, so they reflect one
+// consistent state of the queue even under concurrent changes.
+//
+// Returns:
+//   - The number of members in each bucket.
+//   - ErrInvalidRequest if edges are not strictly ascending.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ScoreCountsAtomic(ctx context.Context, queueID string, edges []float64) ([]int64, error) {
+	args := make([]interface{}, 0, len(edges))
+	for i, edge := range edges {
+		if i > 0 && edge <= edges[i-1] {
+			return nil, ErrInvalidRequest
+		}
+		args = append(args, edge)
+	}
+
+	counts, err := scoreCountsScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(queueKey, queueID)},
+		args...,
+	).
+		Int64Slice()
+	if err != nil {
+		return nil, q.queueErr(ctx, queueID, err)
+	}
+	return counts, nil
+}
+
+// summaryScript returns the first ARGV[1] members of the queue in KEYS[1] as
+// a flat member/score list, the length of the queue and the size of the
+// dequeue set in KEYS[2].
+var summaryScript = redis.NewScript(`
+local n = tonumber(ARGV[1])
+local heads = {}
+if n > 0 then
+	heads = redis.call('ZRANGE', KEYS[1], 0, n - 1, 'WITHSCORES')
+end
+return {heads, redis.call('ZCARD', KEYS[1]), redis.call('SCARD', KEYS[2])}
+`)
+
+// Summary returns the first topN members of the queue with their scores, the
+// length of the queue and the number of dequeued items, as reported by
+// Progress. The three values are read atomically in a single Lua script, so
+// they are consistent with each other, which suits dashboards.
+//
+// Returns:
+//   - The first topN members in dequeue order.
+//   - The number of items in the queue.
+//   - The number of dequeued items.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Summary(ctx context.Context, queueID string, topN int) ([]Member, int64, int64, error) {
+	vals, err := summaryScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(queueKey, queueID),
+			fmt.Sprintf(dequeueKey, queueID),
+		},
+		topN,
+	).
+		Slice()
+	if err != nil {
+		return []Member{}, 0, 0, q.queueErr(ctx, queueID, err)
+	}
+	if len(vals) != 3 {
+		return []Member{}, 0, 0, fmt.Errorf("unexpected summary reply length %d", len(vals))
+	}
+
+	flat, _ := vals[0].([]interface{})
+	heads, err := parseScored(flat)
+	if err != nil {
+		return []Member{}, 0, 0, err
+	}
+	total, _ := vals[1].(int64)
+	dequeued, _ := vals[2].(int64)
+	return toMembers(heads), total, dequeued, nil
+}
+
+// PercentileScore returns the score at the pct-th percentile of the queue,
+// 0 being the head and 100 the tail. The member at rank
+// round(pct/100 × (length-1)) is read, so no interpolation happens between
+// scores.
+//
+// The length and the member are read separately, so the result may be off if
+// the queue changes in between.
+//
+// Returns:
+//   - The score at the given percentile.
+//   - ErrInvalidRequest if pct is not within [0, 100].
+//   - ErrQueueEmpty if the queue is empty.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) PercentileScore(ctx context.Context, queueID string, pct float64) (float64, error) {
+	if !(pct >= 0 && pct <= 100) {
+		return 0, fmt.Errorf("%w: percentile %v out of [0, 100]", ErrInvalidRequest, pct)
+	}
+
+	length, err := q.reader().
+		ZCard(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+		).
+		Result()
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	if length == 0 {
+		return 0, ErrQueueEmpty
+	}
+
+	rank := int64(math.Round(pct / 100 * float64(length-1)))
+	members, err := q.reader().
+		ZRangeWithScores(
+			ctx,
+			fmt.Sprintf(queueKey, queueID),
+			rank,
+			rank,
+		).
+		Result()
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	if len(members) == 0 {
+		return 0, ErrQueueEmpty
+	}
+	return members[0].Score, nil
+}
+
+// scoreQuantileScript returns the score of the member of the queue in KEYS[1]
+// at rank round(ARGV[1] × (length-1)), or nil if the queue is empty.
+var scoreQuantileScript = redis.NewScript(`
+local length = redis.call('ZCARD', KEYS[1])
+if length == 0 then
+	return false
+end
+local rank = math.floor(tonumber(ARGV[1]) * (length - 1) + 0.5)
+return redis.call('ZRANGE', KEYS[1], rank, rank, 'WITHSCORES')[2]
+`)
+
+// ScoreQuantile returns the score at the given quantile of the queue, 0 being
+// the head, 0.5 the median and 1 the tail. Like PercentileScore, it reads the
+// member at rank round(quantile × (length-1)), but the length and the score
+// are read atomically in a single Lua script.
+//
+// Returns:
+//   - The score at the given quantile.
+//   - ErrInvalidRequest if quantile is not within [0, 1].
+//   - ErrQueueEmpty if the queue is empty.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ScoreQuantile(ctx context.Context, queueID string, quantile float64) (float64, error) {
+	if !(quantile >= 0 && quantile <= 1) {
+		return 0, fmt.Errorf("%w: quantile %v out of [0, 1]", ErrInvalidRequest, quantile)
+	}
+
+	score, err := scoreQuantileScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{fmt.Sprintf(queueKey, queueID)},
+		quantile,
+	).
+		Float64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrQueueEmpty
+	}
+	if err != nil {
+		return 0, q.queueErr(ctx, queueID, err)
+	}
+	return score, nil
+}
@@ -0,0 +1,346 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestLifetimeDequeuedAcrossBatches(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t, queue.WithMaxDequeueSet(2))
+
+	for i := 0; i < 10; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for _, n := range []int{3, 1, 4} {
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: n}); err != nil {
+			t.Fatalf("Dequeue(%d): %v", n, err)
+		}
+	}
+	if err := q.ResetThroughput(ctx, "jobs"); err != nil {
+		t.Fatalf("ResetThroughput: %v", err)
+	}
+
+	total, err := q.LifetimeDequeued(ctx, "jobs")
+	if err != nil || total != 8 {
+		t.Fatalf("LifetimeDequeued = %d, %v; want 8", total, err)
+	}
+
+	if err := q.DeleteQueue(ctx, "jobs"); err != nil {
+		t.Fatalf("DeleteQueue: %v", err)
+	}
+	total, err = q.LifetimeDequeued(ctx, "jobs")
+	if err != nil || total != 0 {
+		t.Fatalf("LifetimeDequeued after DeleteQueue = %d, %v; want 0", total, err)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	waiting, dequeued, err := q.Progress(ctx, "jobs")
+	if err != nil || waiting != 0 || dequeued != 0 {
+		t.Fatalf("Progress on an untouched queue = %d, %d, %v; want 0, 0", waiting, dequeued, err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	for _, n := range []int{1, 2} {
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: n}); err != nil {
+			t.Fatalf("Dequeue(%d): %v", n, err)
+		}
+	}
+
+	waiting, dequeued, err = q.Progress(ctx, "jobs")
+	if err != nil || waiting != 2 || dequeued != 3 {
+		t.Fatalf("Progress = %d, %d, %v; want 2, 3", waiting, dequeued, err)
+	}
+}
+
+func TestThroughputCountsDequeuedItems(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	if total, err := q.Throughput(ctx, "jobs"); err != nil || total != 0 {
+		t.Fatalf("Throughput on an untouched queue = %d, %v; want 0", total, err)
+	}
+	for i := 0; i < 6; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	var want int64
+	for _, n := range []int{2, 3} {
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: n}); err != nil {
+			t.Fatalf("Dequeue(%d): %v", n, err)
+		}
+		want += int64(n)
+		if total, err := q.Throughput(ctx, "jobs"); err != nil || total != want {
+			t.Fatalf("Throughput after Dequeue(%d) = %d, %v; want %d", n, total, err, want)
+		}
+	}
+
+	if err := q.ResetThroughput(ctx, "jobs"); err != nil {
+		t.Fatalf("ResetThroughput: %v", err)
+	}
+	if total, err := q.Throughput(ctx, "jobs"); err != nil || total != 0 {
+		t.Fatalf("Throughput after ResetThroughput = %d, %v; want 0", total, err)
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 1}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if total, err := q.Throughput(ctx, "jobs"); err != nil || total != 1 {
+		t.Fatalf("Throughput after reset and Dequeue(1) = %d, %v; want 1", total, err)
+	}
+}
+
+func TestOverviewMixesEmptyAndPopulatedQueues(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for _, req := range []queue.EnqueueReq{
+		{ID: "a", MemberID: "x", Score: 2},
+		{ID: "a", MemberID: "y", Score: 1},
+		{ID: "b", MemberID: "z", Score: 5},
+	} {
+		if err := q.Enqueue(ctx, &req); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	overview, err := q.Overview(ctx, []string{"a", "b", "empty"})
+	if err != nil {
+		t.Fatalf("Overview: %v", err)
+	}
+	want := map[string]queue.QueueOverview{
+		"a":     {Length: 2, Head: "y", HeadScore: 1},
+		"b":     {Length: 1, Head: "z", HeadScore: 5},
+		"empty": {},
+	}
+	if len(overview) != len(want) {
+		t.Fatalf("Overview = %v; want %v", overview, want)
+	}
+	for id, o := range want {
+		if got, ok := overview[id]; !ok || got != o {
+			t.Errorf("Overview[%s] = %+v; want %+v", id, got, o)
+		}
+	}
+}
+
+func TestDequeueSizeStats(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	count, avg, max, err := q.DequeueSizeStats(ctx, "jobs")
+	if err != nil || count != 0 || avg != 0 || max != 0 {
+		t.Fatalf("DequeueSizeStats before any dequeue = %d, %v, %d, %v; want zeros", count, avg, max, err)
+	}
+
+	for i := 0; i < 8; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	// The fourth dequeue asks for 5 but only 2 remain, and the last one
+	// finds the queue empty; neither counts what was not removed.
+	for _, n := range []int{1, 4, 1, 5, 3} {
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: n}); err != nil {
+			t.Fatalf("Dequeue(%d): %v", n, err)
+		}
+	}
+
+	count, avg, max, err = q.DequeueSizeStats(ctx, "jobs")
+	if err != nil || count != 4 || avg != 2 || max != 4 {
+		t.Fatalf("DequeueSizeStats = %d, %v, %d, %v; want 4, 2, 4", count, avg, max, err)
+	}
+}
+
+func TestTotalDequeuedSumsQueues(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for queueID, n := range map[string]int{"a": 1, "b": 3, "c": 2} {
+		for i := 0; i < 4; i++ {
+			if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: queueID, MemberID: fmt.Sprint(i), Score: float64(i)}); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+		}
+		if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: queueID, Number: n}); err != nil {
+			t.Fatalf("Dequeue: %v", err)
+		}
+	}
+
+	total, err := q.TotalDequeued(ctx, []string{"a", "b", "c", "missing"})
+	if err != nil || total != 6 {
+		t.Fatalf("TotalDequeued = %d, %v; want 6", total, err)
+	}
+	if total, err := q.TotalDequeued(ctx, nil); err != nil || total != 0 {
+		t.Fatalf("TotalDequeued(nil) = %d, %v; want 0", total, err)
+	}
+}
+
+func TestScoreCountsAtomic(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	for i, score := range []float64{-5, 0, 1, 1, 5, 9, 10, 42} {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: score}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	counts, err := q.ScoreCountsAtomic(ctx, "jobs", []float64{0, 5, 10})
+	if want := []int64{1, 3, 2, 2}; err != nil || !slices.Equal(counts, want) {
+		t.Fatalf("ScoreCountsAtomic = %v, %v; want %v", counts, err, want)
+	}
+	if _, err := q.ScoreCountsAtomic(ctx, "jobs", []float64{5, 5}); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Fatalf("ScoreCountsAtomic with repeated edges: %v; want ErrInvalidRequest", err)
+	}
+}
+
+func TestScoreCountsAtomicConsistentWithWriters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q, _ := queuetest.NewTestService(t)
+
+	const members = 20
+	for i := 0; i < members; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	// The writers only re-score members, so every consistent histogram adds up
+	// to the same total.
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ctx.Err() == nil; i++ {
+				_ = q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint((w + i) % members), Score: float64((i * 7) % 30)})
+			}
+		}(w)
+	}
+
+	for i := 0; i < 200; i++ {
+		counts, err := q.ScoreCountsAtomic(ctx, "jobs", []float64{5, 10, 20})
+		if err != nil {
+			t.Fatalf("ScoreCountsAtomic: %v", err)
+		}
+		var total int64
+		for _, n := range counts {
+			total += n
+		}
+		if total != members {
+			t.Fatalf("ScoreCountsAtomic = %v adding up to %d; want %d", counts, total, members)
+		}
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestSummaryHeadsAndCounts(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	heads, total, dequeued, err := q.Summary(ctx, "jobs", 3)
+	if err != nil || len(heads) != 0 || total != 0 || dequeued != 0 {
+		t.Fatalf("Summary of an untouched queue = %v, %d, %d, %v; want nothing", heads, total, dequeued, err)
+	}
+
+	for i := 0; i < 6; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%d", i), Score: float64(i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if _, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 2}); err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+
+	tests := []struct {
+		topN int
+		want []queue.Member
+	}{
+		{0, []queue.Member{}},
+		{2, []queue.Member{{MemberID: "m2", Score: 2}, {MemberID: "m3", Score: 3}}},
+		{10, []queue.Member{{MemberID: "m2", Score: 2}, {MemberID: "m3", Score: 3}, {MemberID: "m4", Score: 4}, {MemberID: "m5", Score: 5}}},
+	}
+	for _, tt := range tests {
+		heads, total, dequeued, err := q.Summary(ctx, "jobs", tt.topN)
+		if err != nil || !slices.Equal(heads, tt.want) || total != 4 || dequeued != 2 {
+			t.Errorf("Summary(%d) = %v, %d, %d, %v; want %v, 4, 2", tt.topN, heads, total, dequeued, err, tt.want)
+		}
+	}
+}
+
+func TestPercentileScore(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	if _, err := q.PercentileScore(ctx, "jobs", 50); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("PercentileScore on an empty queue: %v; want ErrQueueEmpty", err)
+	}
+	for i := 0; i <= 10; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: float64(10 * i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for pct, want := range map[float64]float64{0: 0, 25: 30, 50: 50, 99: 100, 100: 100} {
+		score, err := q.PercentileScore(ctx, "jobs", pct)
+		if err != nil || score != want {
+			t.Errorf("PercentileScore(%v) = %v, %v; want %v", pct, score, err, want)
+		}
+	}
+	for _, pct := range []float64{-1, 101, math.NaN()} {
+		if _, err := q.PercentileScore(ctx, "jobs", pct); !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("PercentileScore(%v): %v; want ErrInvalidRequest", pct, err)
+		}
+	}
+}
+
+func TestScoreQuantile(t *testing.T) {
+	ctx := context.Background()
+	q := queuetest.New(t).Service
+
+	if _, err := q.ScoreQuantile(ctx, "jobs", 0.5); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("ScoreQuantile on an empty queue: %v; want ErrQueueEmpty", err)
+	}
+	for i := 0; i <= 10; i++ {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprint(i), Score: float64(10 * i)}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	for quantile, want := range map[float64]float64{0: 0, 0.25: 30, 0.5: 50, 0.99: 100, 1: 100} {
+		score, err := q.ScoreQuantile(ctx, "jobs", quantile)
+		if err != nil || score != want {
+			t.Errorf("ScoreQuantile(%v) = %v, %v; want %v", quantile, score, err, want)
+		}
+		// Both methods pick the same rank.
+		if pct, err := q.PercentileScore(ctx, "jobs", quantile*100); err != nil || pct != score {
+			t.Errorf("PercentileScore(%v) = %v, %v; want %v like ScoreQuantile", quantile*100, pct, err, score)
+		}
+	}
+	for _, quantile := range []float64{-0.1, 1.1, math.NaN()} {
+		if _, err := q.ScoreQuantile(ctx, "jobs", quantile); !errors.Is(err, queue.ErrInvalidRequest) {
+			t.Errorf("ScoreQuantile(%v): %v; want ErrInvalidRequest", quantile, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DrainToStream dequeues the queue in priority order, batchSize items at a
+// time, and appends every item to the Redis Stream streamKey until the queue
+// is empty. Each stream entry has a "member" and a "score" field, so consumer
+// groups can take over the processing of the queue.
+//
+// Items are dequeued like with Dequeue before being added to the stream. If
+// appending a batch fails, the items of that batch are marked as dequeued but
+// missing from the stream.
+//
+// Returns:
+//   - The number of items moved to the stream.
+//   - ErrInvalidRequest if batchSize is not positive.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) DrainToStream(ctx context.Context, queueID, streamKey string, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("%w: batch size must be positive, got %d", ErrInvalidRequest, batchSize)
+	}
+
+	var moved int64
+	for {
+		popped, err := q.dequeue(ctx, &DequeueReq{
+			ID:     queueID,
+			Number: batchSize,
+		})
+		if err != nil {
+			return moved, err
+		}
+		if len(popped) == 0 {
+			return moved, nil
+		}
+
+		pipe := q.redisClient.Pipeline()
+		for _, z := range popped {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: streamKey,
+				Values: []interface{}{
+					"member", z.Member,
+					"score", formatScore(z.Score),
+				},
+			})
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return moved, err
+		}
+		moved += int64(len(popped))
+	}
+}
@@ -0,0 +1,50 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDrainToStreamInPriorityOrder(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if _, err := q.DrainToStream(ctx, "jobs", "export", 0); !errors.Is(err, queue.ErrInvalidRequest) {
+		t.Fatalf("DrainToStream with a zero batch size: %v; want ErrInvalidRequest", err)
+	}
+
+	for i := 4; i >= 0; i-- {
+		if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: fmt.Sprintf("m%d", i), Score: float64(i) + 0.5}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	moved, err := q.DrainToStream(ctx, "jobs", "export", 2)
+	if err != nil || moved != 5 {
+		t.Fatalf("DrainToStream = %d, %v; want 5", moved, err)
+	}
+
+	entries, err := h.Client.XRange(ctx, "export", "-", "+").Result()
+	if err != nil || len(entries) != 5 {
+		t.Fatalf("stream holds %d entries, %v; want 5", len(entries), err)
+	}
+	for i, entry := range entries {
+		wantMember, wantScore := fmt.Sprintf("m%d", i), fmt.Sprintf("%v", float64(i)+0.5)
+		if entry.Values["member"] != wantMember || entry.Values["score"] != wantScore {
+			t.Errorf("entry %d = %v; want member %s with score %s", i, entry.Values, wantMember, wantScore)
+		}
+	}
+	if dequeued, err := q.IsDequeued(ctx, "jobs", "m3"); err != nil || !dequeued {
+		t.Fatalf("IsDequeued(m3) = %v, %v; want true", dequeued, err)
+	}
+
+	if moved, err := q.DrainToStream(ctx, "jobs", "export", 2); err != nil || moved != 0 {
+		t.Fatalf("DrainToStream of an empty queue = %d, %v; want 0", moved, err)
+	}
+}
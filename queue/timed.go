@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// completeScript records the processing duration of the member ARGV[1], from
+// its start time in KEYS[1] to ARGV[2], in KEYS[2]. It returns -1 if no start
+// time is recorded.
+var completeScript = redis.NewScript(`
+local started = redis.call('HGET', KEYS[1], ARGV[1])
+if not started then
+	return -1
+end
+local duration = tonumber(ARGV[2]) - tonumber(started)
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], duration)
+return duration
+`)
+
+// DequeueTimed removes one or more items from the queue like Dequeue and
+// records the time processing of each item started, so that Complete can
+// compute its processing duration. Recording the start times is best effort:
+// if it fails, the items are still returned and Complete reports
+// ErrMemberNotFound for them.
+//
+// Returns:
+//   - A slice of Member containing the dequeued items and their scores.
+//   - An error if the operation fails; otherwise, nil. Items already removed
+//     from the queue when a later step fails are returned along with the
+//     error, so that they are not lost.
+func (q *Service) DequeueTimed(ctx context.Context, in *DequeueReq) ([]Member, error) {
+	popped, err := q.dequeue(ctx, in)
+	if err != nil || len(popped) == 0 {
+		return toMembers(popped), q.queueErr(ctx, in.ID, err)
+	}
+
+	now := time.Now().UnixMilli()
+	started := make(map[string]interface{}, len(popped))
+	for _, z := range popped {
+		started[z.Member.(string)] = now
+	}
+	_ = q.redisClient.HSet(ctx, fmt.Sprintf(processingStartKey, in.ID), started).Err()
+	return toMembers(popped), nil
+}
+
+// Complete marks the processing of an item dequeued with DequeueTimed as done
+// and records its processing duration.
+//
+// Returns:
+//   - ErrMemberNotFound if no processing start time is recorded for the item.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) Complete(ctx context.Context, queueID, memberID string) error {
+	duration, err := completeScript.Run(
+		ctx,
+		q.redisClient,
+		[]string{
+			fmt.Sprintf(processingStartKey, queueID),
+			fmt.Sprintf(processingDurationKey, queueID),
+		},
+		q.member(memberID),
+		time.Now().UnixMilli(),
+	).
+		Int64()
+	if err != nil {
+		return err
+	}
+	if duration < 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// ProcessingDuration returns how long the processing of an item dequeued with
+// DequeueTimed took. For an item not completed yet, the time elapsed since it
+// was dequeued is returned.
+//
+// Returns:
+//   - The processing duration, with millisecond precision.
+//   - ErrMemberNotFound if the item was not dequeued with DequeueTimed.
+//   - An error if the operation fails; otherwise, nil.
+func (q *Service) ProcessingDuration(ctx context.Context, queueID, memberID string) (time.Duration, error) {
+	member := q.member(memberID)
+
+	pipe := q.reader().Pipeline()
+	duration := pipe.HGet(ctx, fmt.Sprintf(processingDurationKey, queueID), member)
+	started := pipe.HGet(ctx, fmt.Sprintf(processingStartKey, queueID), member)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	if ms, err := duration.Int64(); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	if ms, err := started.Int64(); err == nil {
+		return time.Since(time.UnixMilli(ms)).Truncate(time.Millisecond), nil
+	}
+	return 0, ErrMemberNotFound
+}
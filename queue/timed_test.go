@@ -0,0 +1,52 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestDequeueTimedStartTimesBestEffort(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+	q := h.Service
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := h.Client.Set(ctx, "processing_start:jobs", "x", 0).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := q.DequeueTimed(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil {
+		t.Fatalf("DequeueTimed: %v", err)
+	}
+	if len(got) != 1 || got[0].MemberID != "a" {
+		t.Fatalf("DequeueTimed = %v; want [a]", got)
+	}
+	if err := q.Complete(ctx, "jobs", "a"); err == nil {
+		t.Fatal("Complete succeeded without a start time")
+	}
+}
+
+func TestCompleteRecordsDuration(t *testing.T) {
+	ctx := context.Background()
+	q, _ := queuetest.NewTestService(t)
+
+	if err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if _, err := q.DequeueTimed(ctx, &queue.DequeueReq{ID: "jobs"}); err != nil {
+		t.Fatalf("DequeueTimed: %v", err)
+	}
+	if err := q.Complete(ctx, "jobs", "a"); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if err := q.Complete(ctx, "jobs", "a"); !errors.Is(err, queue.ErrMemberNotFound) {
+		t.Fatalf("second Complete = %v; want ErrMemberNotFound", err)
+	}
+}
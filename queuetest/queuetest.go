@@ -0,0 +1,147 @@
+// Package queuetest provides helpers to test code built on top of the queue
+// package against an in-process miniredis server, so that no real Redis has
+// to be running:
+//
+//	q, cleanup := queuetest.NewTestService(t)
+//	defer cleanup()
+//
+// Every test gets its own server, so tests can run in parallel.
+//
+// The queue package works against miniredis, which implements the sorted set,
+// hash, set, string, stream and Lua scripting commands it uses, including
+// BZPOPMIN, with these exceptions:
+//   - OnEmpty relies on keyspace notifications, which miniredis neither
+//     publishes nor lets clients enable with CONFIG SET, so its channel never
+//     fires. Use Harness.SkipUnlessKeyspaceNotifications in tests relying on
+//     it.
+//   - Keys expire based on the server clock, which only moves when the test
+//     calls Harness.FastForward: TTLs, such as WithClearFlagTTL or the cache
+//     of CachedPosition, and leases never elapse on their own.
+//
+// Use Harness.SkipUnlessCommands to skip tests relying on other commands.
+package queuetest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+// Harness bundles a Service with the miniredis server it talks to, and a
+// client connected to the same server to inspect or seed the raw keys.
+type Harness struct {
+	// Service is the Service under test.
+	Service *queue.Service
+
+	// Server is the in-process miniredis server.
+	Server *miniredis.Miniredis
+
+	// Client is the client used by Service.
+	Client *redis.Client
+
+	mu    sync.Mutex
+	now   time.Time
+	close sync.Once
+}
+
+// New starts a miniredis server and returns a Harness with a Service
+// configured with opts. The server is stopped and the client closed when the
+// test completes, or earlier if Close is called. New fails the test if the
+// server cannot be started.
+func New(t testing.TB, opts ...queue.Option) *Harness {
+	t.Helper()
+
+	server := miniredis.NewMiniRedis()
+	if err := server.Start(); err != nil {
+		t.Fatalf("queuetest: start miniredis: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr: server.Addr(),
+	})
+
+	q, err := queue.NewService(context.Background(), client, opts...)
+	if err != nil {
+		client.Close()
+		server.Close()
+		t.Fatalf("queuetest: new service: %v", err)
+	}
+
+	now := time.Now()
+	server.SetTime(now)
+	h := &Harness{
+		Service: q,
+		Server:  server,
+		Client:  client,
+		now:     now,
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// NewTestService returns a Service backed by a fresh miniredis server and
+// configured with opts, along with a cleanup function stopping the server.
+// The cleanup function is also registered with t.Cleanup, and calling it more
+// than once is harmless.
+func NewTestService(t testing.TB, opts ...queue.Option) (*queue.Service, func()) {
+	t.Helper()
+
+	h := New(t, opts...)
+	return h.Service, h.Close
+}
+
+// Close closes the client and stops the server.
+func (h *Harness) Close() {
+	h.close.Do(func() {
+		h.Client.Close()
+		h.Server.Close()
+	})
+}
+
+// FastForward moves the server clock forward by d, expiring the keys whose
+// TTL elapses and advancing the time reported by the TIME command.
+func (h *Harness) FastForward(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.now = h.now.Add(d)
+	h.Server.SetTime(h.now)
+	h.Server.FastForward(d)
+}
+
+// Supports reports whether the server implements every given command.
+func (h *Harness) Supports(commands ...string) bool {
+	for _, command := range commands {
+		if !h.Server.Server().IsRegisteredCommand(strings.ToUpper(command)) {
+			return false
+		}
+	}
+	return true
+}
+
+// SkipUnlessCommands skips the test unless the server implements every given
+// command.
+func (h *Harness) SkipUnlessCommands(t testing.TB, commands ...string) {
+	t.Helper()
+
+	for _, command := range commands {
+		if !h.Supports(command) {
+			t.Skipf("queuetest: %s is not supported by miniredis", strings.ToUpper(command))
+		}
+	}
+}
+
+// SkipUnlessKeyspaceNotifications skips the test unless the server can
+// publish keyspace notifications, which OnEmpty relies on.
+func (h *Harness) SkipUnlessKeyspaceNotifications(t testing.TB) {
+	t.Helper()
+
+	if !h.Supports("CONFIG") {
+		t.Skip("queuetest: keyspace notifications are not supported by miniredis")
+	}
+}
@@ -0,0 +1,95 @@
+package queuetest_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/p40pmn/priority-queue/queue"
+	"github.com/p40pmn/priority-queue/queuetest"
+)
+
+func TestNewTestService(t *testing.T) {
+	ctx := context.Background()
+	q, cleanup := queuetest.NewTestService(t)
+	defer cleanup()
+
+	for i, id := range []string{"c", "a", "b"} {
+		err := q.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: id, Score: float64([]int{3, 1, 2}[i])})
+		if err != nil {
+			t.Fatalf("Enqueue(%s): %v", id, err)
+		}
+	}
+
+	pos, err := q.GetPosition(ctx, &queue.PositionReq{ID: "jobs", MemberID: "b"})
+	if err != nil || pos != 1 {
+		t.Fatalf("GetPosition(b) = %d, %v; want 1, nil", pos, err)
+	}
+
+	got, err := q.Dequeue(ctx, &queue.DequeueReq{ID: "jobs", Number: 3})
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("Dequeue = %v; want %v", got, want)
+	}
+
+	_, err = q.GetPosition(ctx, &queue.PositionReq{ID: "jobs", MemberID: "b"})
+	if !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("GetPosition on empty queue: %v; want ErrQueueEmpty", err)
+	}
+}
+
+func TestNewTestServiceIsolated(t *testing.T) {
+	ctx := context.Background()
+	first, _ := queuetest.NewTestService(t)
+	second, _ := queuetest.NewTestService(t)
+
+	if err := first.Enqueue(ctx, &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	got, err := second.Dequeue(ctx, &queue.DequeueReq{ID: "jobs"})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("Dequeue on second server = %v, %v; want no items", got, err)
+	}
+}
+
+func TestHarnessCleanupIdempotent(t *testing.T) {
+	h := queuetest.New(t)
+	h.Close()
+	h.Close()
+
+	if err := h.Service.Enqueue(context.Background(), &queue.EnqueueReq{ID: "jobs", MemberID: "a"}); err == nil {
+		t.Fatal("Enqueue after Close succeeded; want an error")
+	}
+}
+
+func TestHarnessSupports(t *testing.T) {
+	h := queuetest.New(t)
+
+	if !h.Supports("zadd", "EVALSHA", "BZPOPMIN", "HSETNX") {
+		t.Error("Supports reported a missing command the queue relies on")
+	}
+	if h.Supports("CONFIG") {
+		t.Error("Supports(CONFIG) = true; miniredis has no CONFIG")
+	}
+}
+
+func TestHarnessFastForward(t *testing.T) {
+	ctx := context.Background()
+	h := queuetest.New(t)
+
+	if err := h.Client.Set(ctx, "k", "v", time.Second).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	before := h.Client.Time(ctx).Val()
+	h.FastForward(2 * time.Second)
+	if n := h.Client.Exists(ctx, "k").Val(); n != 0 {
+		t.Fatalf("key still exists after its TTL elapsed")
+	}
+	if elapsed := h.Client.Time(ctx).Val().Sub(before); elapsed != 2*time.Second {
+		t.Fatalf("TIME moved by %v; want 2s", elapsed)
+	}
+}